@@ -0,0 +1,226 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Какая попытка идёт в оценку за тест (tests.grading_policy)
+const (
+	gradingBest    = "best"    // лучшая из завершённых
+	gradingLast    = "last"    // последняя завершённая
+	gradingAverage = "average" // среднее по завершённым
+)
+
+// defaultMaxAttempts — лимит попыток нового теста, если преподаватель его не задал
+const defaultMaxAttempts = 2
+
+func validGradingPolicy(p string) bool {
+	return p == gradingBest || p == gradingLast || p == gradingAverage
+}
+
+// validAttemptSettings проверяет лимит попыток (0 — без ограничения)
+// и паузу между попытками в минутах
+func validAttemptSettings(maxAttempts, cooldown int) bool {
+	return maxAttempts >= 0 && maxAttempts <= 100 && cooldown >= 0 && cooldown <= 30*24*60
+}
+
+// attemptDenied — отказ в новой попытке с понятным студенту сообщением
+type attemptDenied struct {
+	Status     int
+	Msg        string
+	RetryAfter time.Duration // для паузы между попытками
+}
+
+func (e *attemptDenied) Error() string { return e.Msg }
+
+// attemptStatus — сколько попыток сделано и когда можно начать следующую
+type attemptStatus struct {
+	Done          int        `json:"attemptsDone"`
+	MaxAttempts   int        `json:"maxAttempts"`             // 0 — без ограничения
+	AttemptsLeft  *int       `json:"attemptsLeft"`            // nil — без ограничения
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"` // если действует пауза
+}
+
+// loadAttemptStatus считает попытки пользователя по тесту с учётом настроек теста.
+// sql.ErrNoRows — теста нет.
+func loadAttemptStatus(q queryer, userID, testID int) (attemptStatus, error) {
+	var (
+		st       attemptStatus
+		cooldown int
+		next     sql.NullTime
+	)
+	err := q.QueryRow(`
+        SELECT t.max_attempts,
+               t.attempt_cooldown,
+               (SELECT COUNT(*) FROM user_test_attempts a
+                 WHERE a.user_id = $1 AND a.test_id = t.id),
+               (SELECT MAX(a.finished_at) + make_interval(mins => t.attempt_cooldown)
+                  FROM user_test_attempts a
+                 WHERE a.user_id = $1 AND a.test_id = t.id)
+          FROM tests t
+         WHERE t.id = $2
+    `, userID, testID).Scan(&st.MaxAttempts, &cooldown, &st.Done, &next)
+	if err != nil {
+		return st, err
+	}
+	if st.MaxAttempts > 0 {
+		left := max(st.MaxAttempts-st.Done, 0)
+		st.AttemptsLeft = &left
+	}
+	if cooldown > 0 && next.Valid && next.Time.After(time.Now()) {
+		st.NextAttemptAt = &next.Time
+	}
+	return st, nil
+}
+
+// openAttempt — незавершённая попытка, которую студент продолжает
+// вместо того, чтобы начинать новую
+type openAttempt struct {
+	ID       int
+	Number   int
+	Deadline sql.NullTime
+}
+
+// resumableAttempt находит незавершённую попытку пользователя по тесту.
+// Попытку с истёкшим дедлайном завершает (не дожидаясь FinishExpiredAttempts)
+// и возвращает ok == false: тогда можно начинать новую. Попытки тестов без
+// лимита времени не истекают, поэтому брошенную попытку студент продолжает.
+func resumableAttempt(q queryer, userID, testID int) (a openAttempt, ok bool, err error) {
+	var expired bool
+	err = q.QueryRow(`
+        SELECT id, attempt_number, deadline_at,
+               COALESCE(deadline_at + make_interval(secs => $3) < NOW(), false)
+          FROM user_test_attempts
+         WHERE user_id = $1 AND test_id = $2 AND finished_at IS NULL
+         ORDER BY started_at DESC
+         LIMIT 1
+    `, userID, testID, attemptGracePeriod).Scan(&a.ID, &a.Number, &a.Deadline, &expired)
+	if err == sql.ErrNoRows {
+		return a, false, nil
+	} else if err != nil {
+		return a, false, err
+	}
+	if expired {
+		return a, false, closeAttempt(q, a.ID)
+	}
+	return a, true, nil
+}
+
+// checkAttemptAllowed решает, можно ли начать новую попытку.
+// Возвращает *attemptDenied, если нельзя по настройкам теста.
+func checkAttemptAllowed(q queryer, userID, testID int) error {
+	st, err := loadAttemptStatus(q, userID, testID)
+	if err == sql.ErrNoRows {
+		return &attemptDenied{Status: http.StatusNotFound, Msg: "Тест не найден"}
+	} else if err != nil {
+		return err
+	}
+
+	if st.AttemptsLeft != nil && *st.AttemptsLeft == 0 {
+		return &attemptDenied{
+			Status: http.StatusForbidden,
+			Msg:    fmt.Sprintf("Лимит попыток исчерпан: использовано %d из %d", st.Done, st.MaxAttempts),
+		}
+	}
+	if st.NextAttemptAt != nil {
+		wait := time.Until(*st.NextAttemptAt)
+		return &attemptDenied{
+			Status:     http.StatusTooManyRequests,
+			Msg:        fmt.Sprintf("Следующая попытка будет доступна через %d мин.", int(math.Ceil(wait.Minutes()))),
+			RetryAfter: wait,
+		}
+	}
+	return nil
+}
+
+// effectiveGrade — оценка за тест с учётом политики пересдач
+type effectiveGrade struct {
+	TestID        int      `json:"test_id"`
+	GradingPolicy string   `json:"grading_policy"`
+	Attempts      int      `json:"attempts"` // завершённых попыток
+	Grade         *float64 `json:"grade"`    // nil — завершённых попыток нет
+	MaxScore      float64  `json:"max_score"`
+}
+
+// effectiveGradeSQL — агрегат итоговой оценки по политике пересдач;
+// ожидает t (tests) и a (завершённые user_test_attempts) в запросе с GROUP BY
+const effectiveGradeSQL = `
+               CASE t.grading_policy
+                   WHEN 'last'    THEN (ARRAY_AGG(a.score ORDER BY a.finished_at DESC))[1]
+                   WHEN 'average' THEN AVG(a.score)
+                   ELSE MAX(a.score)
+               END`
+
+// loadEffectiveGrade вычисляет оценку пользователя за тест по завершённым попыткам
+func loadEffectiveGrade(q queryer, userID, testID int) (effectiveGrade, error) {
+	g := effectiveGrade{TestID: testID}
+	var grade sql.NullFloat64
+	err := q.QueryRow(`
+        SELECT t.grading_policy,
+               (SELECT COALESCE(SUM(points), 0) FROM questions WHERE test_id = t.id),
+               COUNT(a.id),`+effectiveGradeSQL+`
+          FROM tests t
+          LEFT JOIN user_test_attempts a
+            ON a.test_id = t.id AND a.user_id = $1 AND a.finished_at IS NOT NULL
+         WHERE t.id = $2
+         GROUP BY t.id
+    `, userID, testID).Scan(&g.GradingPolicy, &g.MaxScore, &g.Attempts, &grade)
+	if err != nil {
+		return g, err
+	}
+	if grade.Valid {
+		v := math.Round(grade.Float64*100) / 100
+		g.Grade = &v
+	}
+	return g, nil
+}
+
+// GET /api/tests/{testId}/grade — итоговая оценка за тест по политике пересдач
+func GetEffectiveGrade(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/tests/"), "/")
+	if len(parts) != 2 || parts[1] != "grade" {
+		http.NotFound(w, r)
+		return
+	}
+	testID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid test ID", http.StatusBadRequest)
+		return
+	}
+
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Не авторизован", http.StatusUnauthorized)
+		return
+	}
+	userID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
+	}
+
+	g, err := loadEffectiveGrade(db, userID, testID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Тест не найден", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("GetEffectiveGrade error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g)
+}
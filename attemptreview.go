@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// attemptReview — разбор попытки по вопросам
+type attemptReview struct {
+	AttemptID      int                     `json:"attempt_id"`
+	TestID         int                     `json:"test_id"`
+	UserID         int                     `json:"user_id"`
+	AttemptNumber  int                     `json:"attempt_number"`
+	StartedAt      time.Time               `json:"started_at"`
+	FinishedAt     *time.Time              `json:"finished_at"`
+	Score          float64                 `json:"score"`
+	MaxScore       float64                 `json:"max_score"`
+	CorrectAnswers int                     `json:"correct_answers"`
+	WrongAnswers   int                     `json:"wrong_answers"`
+	ShowAnswers    bool                    `json:"show_answers"` // виден ли ключ ответов
+	Questions      []attemptReviewQuestion `json:"questions"`
+}
+
+// attemptReviewQuestion — один вопрос попытки: что ответил студент и сколько получил.
+// Поля Correct* заполняются, только если политика теста разрешает показ ключа.
+type attemptReviewQuestion struct {
+	QuestionID        int                   `json:"question_id"`
+	QuestionText      string                `json:"question_text"`
+	QuestionType      string                `json:"question_type"`
+	MultipleChoice    bool                  `json:"multiple_choice"`
+	SetDefinitions    SetDefinitions        `json:"set_definitions,omitempty"`
+	Options           []attemptReviewOption `json:"options,omitempty"`
+	Answered          bool                  `json:"answered"`
+	SelectedOptionIDs []int64               `json:"selected_option_ids,omitempty"`
+	AnswerText        string                `json:"answer_text,omitempty"`
+	AnswerSet         string                `json:"answer_set,omitempty"` // вычисленное множество ответа
+	IsCorrect         bool                  `json:"is_correct"`
+	Points            float64               `json:"points"`
+	MaxPoints         float64               `json:"max_points"`
+	CorrectAnswerText string                `json:"correct_answer_text,omitempty"`
+	CorrectSet        string                `json:"correct_set,omitempty"`
+	ReviewStatus      string                `json:"review_status,omitempty"`
+
+	setTemplate SetTemplate
+}
+
+type attemptReviewOption struct {
+	ID         int    `json:"id"`
+	OptionText string `json:"option_text"`
+	Selected   bool   `json:"selected"`
+	IsCorrect  *bool  `json:"is_correct,omitempty"`
+}
+
+// canViewAttempt — попытку видит её владелец, администратор и преподаватель,
+// который ведёт курс теста или группу студента
+func canViewAttempt(q queryer, role string, viewerID, ownerID, testID int) (bool, error) {
+	if viewerID == ownerID || role == "admin" {
+		return true, nil
+	}
+	if role != "teacher" {
+		return false, nil
+	}
+	var ok bool
+	err := q.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM tests t JOIN courses c ON c.id = t.course_id
+                       WHERE t.id = $1 AND c.teacher_id = $2)
+            OR EXISTS(SELECT 1 FROM student_groups sg JOIN groups g ON g.id = sg.group_id
+                       WHERE sg.student_id = $3 AND sg.removed_at IS NULL AND g.teacher_id = $2)
+    `, testID, viewerID, ownerID).Scan(&ok)
+	return ok, err
+}
+
+// loadAttemptReview собирает разбор попытки из user_question_answers.
+// Вопросы идут в том порядке, в котором их видела попытка.
+func loadAttemptReview(q queryer, attemptID int, showKey bool) (attemptReview, error) {
+	var (
+		rv       attemptReview
+		finished sql.NullTime
+		seed     int64
+		order    attemptOrder
+	)
+	err := q.QueryRow(`
+        SELECT id, test_id, user_id, attempt_number, started_at, finished_at,
+               score, correct_answers, wrong_answers, seed, question_order
+          FROM user_test_attempts
+         WHERE id = $1
+    `, attemptID).Scan(
+		&rv.AttemptID, &rv.TestID, &rv.UserID, &rv.AttemptNumber, &rv.StartedAt, &finished,
+		&rv.Score, &rv.CorrectAnswers, &rv.WrongAnswers, &seed, &order,
+	)
+	if err != nil {
+		return rv, err
+	}
+	if finished.Valid {
+		rv.FinishedAt = &finished.Time
+	}
+	rv.ShowAnswers = showKey
+
+	rows, err := q.Query(`
+        SELECT q.id, q.question_text, q.question_type, q.multiple_choice,
+               q.correct_answer_text, q.set_definitions, q.set_template, q.points,
+               a.id IS NOT NULL, COALESCE(a.is_correct, false), COALESCE(a.points, 0),
+               a.selected_option_ids, COALESCE(a.answer_text, ''), COALESCE(a.answer_set, ''),
+               COALESCE(a.review_status, '')
+          FROM questions q
+          LEFT JOIN user_question_answers a
+            ON a.question_id = q.id AND a.attempt_id = $1
+         WHERE q.test_id = $2
+         ORDER BY q.id
+    `, attemptID, rv.TestID)
+	if err != nil {
+		return rv, err
+	}
+	byID := map[int]*attemptReviewQuestion{}
+	var ids []int
+	for rows.Next() {
+		var (
+			rq      attemptReviewQuestion
+			correct sql.NullString
+		)
+		if err := rows.Scan(
+			&rq.QuestionID, &rq.QuestionText, &rq.QuestionType, &rq.MultipleChoice,
+			&correct, &rq.SetDefinitions, &rq.setTemplate, &rq.MaxPoints,
+			&rq.Answered, &rq.IsCorrect, &rq.Points,
+			pq.Array(&rq.SelectedOptionIDs), &rq.AnswerText, &rq.AnswerSet,
+			&rq.ReviewStatus,
+		); err != nil {
+			rows.Close()
+			return rv, err
+		}
+		if showKey && rq.QuestionType != "closed" {
+			rq.CorrectAnswerText = correct.String
+		}
+		rv.MaxScore += rq.MaxPoints
+		byID[rq.QuestionID] = &rq
+		ids = append(ids, rq.QuestionID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rv, err
+	}
+
+	// Варианты закрытых вопросов — в порядке попытки
+	optRows, err := q.Query(`
+        SELECT o.id, o.question_id, o.option_text, o.is_correct
+          FROM options o
+          JOIN questions q ON q.id = o.question_id
+         WHERE q.test_id = $1
+         ORDER BY o.id
+    `, rv.TestID)
+	if err != nil {
+		return rv, err
+	}
+	options := map[int]map[int]attemptReviewOption{}
+	optionIDs := map[int][]int{}
+	for optRows.Next() {
+		var (
+			o         attemptReviewOption
+			qid       int
+			isCorrect bool
+		)
+		if err := optRows.Scan(&o.ID, &qid, &o.OptionText, &isCorrect); err != nil {
+			optRows.Close()
+			return rv, err
+		}
+		if showKey {
+			o.IsCorrect = &isCorrect
+		}
+		if options[qid] == nil {
+			options[qid] = map[int]attemptReviewOption{}
+		}
+		options[qid][o.ID] = o
+		optionIDs[qid] = append(optionIDs[qid], o.ID)
+	}
+	optRows.Close()
+	if err := optRows.Err(); err != nil {
+		return rv, err
+	}
+
+	for _, id := range arrange(ids, order.Questions) {
+		rq := byID[id]
+		selected := map[int]bool{}
+		for _, oid := range rq.SelectedOptionIDs {
+			selected[int(oid)] = true
+		}
+		for _, oid := range arrange(optionIDs[id], order.Options[id]) {
+			o := options[id][oid]
+			o.Selected = selected[oid]
+			rq.Options = append(rq.Options, o)
+		}
+		// множества шаблонного вопроса — те, что были в этой попытке
+		if rq.setTemplate != nil {
+			defs, err := rq.setTemplate.instantiate(seed, id)
+			if err != nil {
+				log.Println("Instantiate template error:", err)
+			} else {
+				rq.SetDefinitions = defs
+			}
+		}
+		if showKey && rq.QuestionType == questionTypeSet && rq.SetDefinitions != nil {
+			rq.CorrectSet = correctSet(rq.SetDefinitions, rq.CorrectAnswerText)
+		}
+		rv.Questions = append(rv.Questions, *rq)
+	}
+	return rv, nil
+}
+
+// GET /api/attempts/{id} — разбор попытки: ответы, баллы и (если политика
+// теста позволяет) правильные ответы. Преподаватель может открыть попытку
+// любого своего студента.
+func GetAttemptReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	attemptID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/attempts/"))
+	if err != nil {
+		http.Error(w, "Invalid attempt ID", http.StatusBadRequest)
+		return
+	}
+
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Не авторизован", http.StatusUnauthorized)
+		return
+	}
+	viewerID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
+	}
+
+	var ownerID, testID int
+	err = db.QueryRow(
+		`SELECT user_id, test_id FROM user_test_attempts WHERE id = $1`, attemptID,
+	).Scan(&ownerID, &testID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Попытка не найдена", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	allowed, err := canViewAttempt(db, claims.Role, viewerID, ownerID, testID)
+	if err != nil {
+		log.Println("canViewAttempt error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		// не раскрываем, что чужая попытка существует
+		http.Error(w, "Попытка не найдена", http.StatusNotFound)
+		return
+	}
+
+	showKey, err := canSeeAnswerKey(db, claims.Role, ownerID, testID)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	review, err := loadAttemptReview(db, attemptID, showKey)
+	if err != nil {
+		log.Println("loadAttemptReview error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, review)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxCommentLength — ограничение длины комментария в символах
+const maxCommentLength = 4000
+
+// attemptComment — комментарий преподавателя к попытке или к отдельному ответу
+type attemptComment struct {
+	ID         int        `json:"id"`
+	AttemptID  int        `json:"attempt_id"`
+	AnswerID   *int       `json:"answer_id,omitempty"`
+	QuestionID *int       `json:"question_id,omitempty"`
+	AuthorID   int        `json:"author_id"`
+	AuthorName string     `json:"author_name"`
+	Body       string     `json:"body"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	ReadAt     *time.Time `json:"read_at,omitempty"`
+}
+
+// feedbackItem — комментарий в ленте студента вместе с тестом, к которому он относится
+type feedbackItem struct {
+	attemptComment
+	TestID       int    `json:"test_id"`
+	TestTitle    string `json:"test_title"`
+	QuestionText string `json:"question_text,omitempty"`
+}
+
+const commentColumns = `
+        cm.id, cm.attempt_id, cm.answer_id, cm.question_id, cm.author_id, u.full_name,
+        cm.body, cm.created_at, cm.updated_at, cm.read_at`
+
+func scanComment(rows *sql.Rows, c *attemptComment, extra ...interface{}) error {
+	var (
+		answerID, questionID sql.NullInt64
+		updated, read        sql.NullTime
+	)
+	dest := append([]interface{}{
+		&c.ID, &c.AttemptID, &answerID, &questionID, &c.AuthorID, &c.AuthorName,
+		&c.Body, &c.CreatedAt, &updated, &read,
+	}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	if answerID.Valid {
+		id := int(answerID.Int64)
+		c.AnswerID = &id
+	}
+	if questionID.Valid {
+		id := int(questionID.Int64)
+		c.QuestionID = &id
+	}
+	if updated.Valid {
+		c.UpdatedAt = &updated.Time
+	}
+	if read.Valid {
+		c.ReadAt = &read.Time
+	}
+	return nil
+}
+
+// validCommentBody — непустой текст разумной длины
+func validCommentBody(body string) bool {
+	n := len([]rune(strings.TrimSpace(body)))
+	return n > 0 && n <= maxCommentLength
+}
+
+// AttemptCommentsHandler — обсуждение попытки
+//
+//	GET    /api/attempts/{id}/comments        — комментарии (студент при этом их «прочитывает»)
+//	POST   /api/attempts/{id}/comments        — новый комментарий преподавателя
+//	PUT    /api/attempts/{id}/comments/{cid}  — правка своего комментария
+//	DELETE /api/attempts/{id}/comments/{cid}  — удаление своего комментария
+func AttemptCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/attempts/"), "/")
+	attemptID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid attempt ID", http.StatusBadRequest)
+		return
+	}
+	commentID := 0
+	if len(parts) == 3 {
+		if commentID, err = strconv.Atoi(parts[2]); err != nil {
+			http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Не авторизован", http.StatusUnauthorized)
+		return
+	}
+	viewerID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
+	}
+
+	var ownerID, testID int
+	err = db.QueryRow(
+		`SELECT user_id, test_id FROM user_test_attempts WHERE id = $1`, attemptID,
+	).Scan(&ownerID, &testID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Попытка не найдена", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	allowed, err := canViewAttempt(db, claims.Role, viewerID, ownerID, testID)
+	if err != nil {
+		log.Println("canViewAttempt error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Попытка не найдена", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case commentID == 0 && r.Method == http.MethodGet:
+		listAttemptComments(w, attemptID, viewerID == ownerID)
+	case commentID == 0 && r.Method == http.MethodPost:
+		if claims.Role != "teacher" && claims.Role != "admin" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		createAttemptComment(w, r, attemptID, viewerID)
+	case commentID != 0 && r.Method == http.MethodPut:
+		updateAttemptComment(w, r, attemptID, commentID, viewerID)
+	case commentID != 0 && r.Method == http.MethodDelete:
+		deleteAttemptComment(w, attemptID, commentID, viewerID, claims.Role == "admin")
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listAttemptComments(w http.ResponseWriter, attemptID int, isOwner bool) {
+	rows, err := db.Query(`
+        SELECT`+commentColumns+`
+          FROM attempt_comments cm
+          JOIN users u ON u.id = cm.author_id
+         WHERE cm.attempt_id = $1
+         ORDER BY cm.created_at, cm.id
+    `, attemptID)
+	if err != nil {
+		log.Println("listAttemptComments error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	comments := []attemptComment{}
+	for rows.Next() {
+		var c attemptComment
+		if err := scanComment(rows, &c); err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		comments = append(comments, c)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	// студент открыл обсуждение — всё, что в нём есть, прочитано
+	if isOwner {
+		if _, err := db.Exec(
+			`UPDATE attempt_comments SET read_at = NOW() WHERE attempt_id = $1 AND read_at IS NULL`,
+			attemptID,
+		); err != nil {
+			log.Println("mark comments read error:", err)
+		}
+	}
+	respondWithJSON(w, http.StatusOK, comments)
+}
+
+func createAttemptComment(w http.ResponseWriter, r *http.Request, attemptID, authorID int) {
+	var req struct {
+		Body     string `json:"body"`
+		AnswerID *int   `json:"answer_id"` // nil — комментарий ко всей попытке
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if !validCommentBody(req.Body) {
+		http.Error(w, "Комментарий пуст или слишком длинный", http.StatusBadRequest)
+		return
+	}
+
+	var questionID *int
+	if req.AnswerID != nil {
+		var qid int
+		err := db.QueryRow(
+			`SELECT question_id FROM user_question_answers WHERE id = $1 AND attempt_id = $2`,
+			*req.AnswerID, attemptID,
+		).Scan(&qid)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Ответ не относится к этой попытке", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		questionID = &qid
+	}
+
+	var id int
+	err := db.QueryRow(`
+        INSERT INTO attempt_comments (attempt_id, answer_id, question_id, author_id, body)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id
+    `, attemptID, req.AnswerID, questionID, authorID, strings.TrimSpace(req.Body)).Scan(&id)
+	if err != nil {
+		log.Println("createAttemptComment error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]int{"id": id})
+}
+
+func updateAttemptComment(w http.ResponseWriter, r *http.Request, attemptID, commentID, authorID int) {
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if !validCommentBody(req.Body) {
+		http.Error(w, "Комментарий пуст или слишком длинный", http.StatusBadRequest)
+		return
+	}
+
+	// исправленный комментарий снова появляется у студента как непрочитанный
+	res, err := db.Exec(`
+        UPDATE attempt_comments
+           SET body = $1, updated_at = NOW(), read_at = NULL
+         WHERE id = $2 AND attempt_id = $3 AND author_id = $4
+    `, strings.TrimSpace(req.Body), commentID, attemptID, authorID)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Комментарий не найден", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deleteAttemptComment(w http.ResponseWriter, attemptID, commentID, authorID int, isAdmin bool) {
+	res, err := db.Exec(`
+        DELETE FROM attempt_comments
+         WHERE id = $1 AND attempt_id = $2 AND ($3 OR author_id = $4)
+    `, commentID, attemptID, isAdmin, authorID)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Комментарий не найден", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MyFeedbackHandler — отзывы преподавателей на попытки текущего пользователя
+//
+//	GET  /api/me/feedback[?unread=1] — лента комментариев, новые сверху
+//	POST /api/me/feedback/read       — отметить прочитанными {"ids": [...]}; пустой список — все
+func MyFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Не авторизован", http.StatusUnauthorized)
+		return
+	}
+	userID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/api/me/feedback" && r.Method == http.MethodGet:
+		onlyUnread := r.URL.Query().Get("unread") == "1"
+		rows, err := db.Query(`
+            SELECT`+commentColumns+`, t.id, t.title, COALESCE(q.question_text, '')
+              FROM attempt_comments cm
+              JOIN users u               ON u.id = cm.author_id
+              JOIN user_test_attempts a  ON a.id = cm.attempt_id
+              JOIN tests t               ON t.id = a.test_id
+              LEFT JOIN questions q      ON q.id = cm.question_id
+             WHERE a.user_id = $1
+               AND (NOT $2 OR cm.read_at IS NULL)
+             ORDER BY cm.created_at DESC, cm.id DESC
+        `, userID, onlyUnread)
+		if err != nil {
+			log.Println("MyFeedbackHandler error:", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		items := []feedbackItem{}
+		unread := 0
+		for rows.Next() {
+			var it feedbackItem
+			if err := scanComment(rows, &it.attemptComment, &it.TestID, &it.TestTitle, &it.QuestionText); err != nil {
+				http.Error(w, "DB error", http.StatusInternalServerError)
+				return
+			}
+			if it.ReadAt == nil {
+				unread++
+			}
+			items = append(items, it)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"unread":   unread,
+			"comments": items,
+		})
+
+	case r.URL.Path == "/api/me/feedback/read" && r.Method == http.MethodPost:
+		var req struct {
+			IDs []int64 `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+		_, err := db.Exec(`
+            UPDATE attempt_comments cm
+               SET read_at = NOW()
+              FROM user_test_attempts a
+             WHERE a.id = cm.attempt_id
+               AND a.user_id = $1
+               AND cm.read_at IS NULL
+               AND (COALESCE(cardinality($2::int[]), 0) = 0 OR cm.id = ANY($2))
+        `, userID, pq.Array(req.IDs))
+		if err != nil {
+			log.Println("mark feedback read error:", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
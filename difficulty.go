@@ -2,74 +2,439 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"sync"
+
+	"github.com/lib/pq"
+	"github.com/robfig/cron/v3"
 )
 
-// RecalcDifficulty пересчитывает поле difficulty в таблице questions
-// на основе статистики из user_question_answers.
-func RecalcDifficulty(db *sql.DB) error {
-	const query = `
-WITH stats AS (
-  SELECT
-    question_id,
-    COUNT(*)           AS total_attempts,
-    SUM(CASE WHEN is_correct THEN 1 ELSE 0 END)::FLOAT AS correct_count
-  FROM user_question_answers
-  GROUP BY question_id
-  HAVING COUNT(*) >= 50
+// Методы пересчёта сложности
+const (
+	recalcMethodRatio = "ratio" // по доле верных ответов
+	recalcMethodIRT   = "irt"   // калибровка по модели Раша (см. irt.go)
 )
-UPDATE questions q
-   SET difficulty = CASE
-       WHEN s.correct_count / s.total_attempts >= 0.7 THEN 'easy'
-       WHEN s.correct_count / s.total_attempts <= 0.3 THEN 'hard'
-       ELSE 'medium'
-   END
-  FROM stats s
- WHERE q.id = s.question_id
-   AND q.difficulty IS DISTINCT FROM
-       CASE
-         WHEN s.correct_count / s.total_attempts >= 0.7 THEN 'easy'
-         WHEN s.correct_count / s.total_attempts <= 0.3 THEN 'hard'
-         ELSE 'medium'
-       END;
-`
-	res, err := db.Exec(query)
-	if err != nil {
-		return err
+
+// recalcPolicy — настройки пересчёта сложности; хранятся единственной строкой
+// в difficulty_policy и меняются через /api/admin/difficulty/policy
+type recalcPolicy struct {
+	Method     string  `json:"method"`
+	MinAnswers int     `json:"min_answers"` // с меньшим числом ответов метка вопроса не меняется
+	EasyShare  float64 `json:"easy_share"`  // доля верных ответов, начиная с которой вопрос easy
+	HardShare  float64 `json:"hard_share"`  // доля, до которой включительно вопрос hard
+	Schedule   string  `json:"schedule"`    // расписание ночного пересчёта в формате cron
+}
+
+// defaultRecalcPolicy — на случай, если строки в difficulty_policy нет
+var defaultRecalcPolicy = recalcPolicy{
+	Method:     recalcMethodRatio, // irt администратор включает через /api/admin/difficulty/policy
+	MinAnswers: 50,
+	EasyShare:  0.7,
+	HardShare:  0.3,
+	Schedule:   "0 3 * * *",
+}
+
+var (
+	errRecalcBusy    = errors.New("пересчёт сложности уже выполняется")
+	errRunRolledBack = errors.New("пересчёт уже откатан")
+	recalcMu         sync.Mutex
+	recalcCron       *cron.Cron
+	recalcEntry      cron.EntryID
+	recalcScheduleMu sync.Mutex
+)
+
+func (p recalcPolicy) validate() error {
+	if p.Method != recalcMethodRatio && p.Method != recalcMethodIRT {
+		return errors.New("method: irt или ratio")
+	}
+	if p.MinAnswers < 1 {
+		return errors.New("min_answers должен быть не меньше 1")
+	}
+	if !(0 < p.HardShare && p.HardShare < p.EasyShare && p.EasyShare < 1) {
+		return errors.New("нужно 0 < hard_share < easy_share < 1")
+	}
+	if _, err := cron.ParseStandard(p.Schedule); err != nil {
+		return fmt.Errorf("schedule: %v", err)
 	}
-	count, _ := res.RowsAffected()
-	log.Printf("RecalcDifficulty: updated %d rows\n", count)
 	return nil
 }
 
-func RecalcDifficultyML(db *sql.DB) error {
-	rows, err := db.Query(`SELECT id, question_text FROM questions`)
+// label — метка по доле верных ответов
+func (p recalcPolicy) label(share float64) string {
+	switch {
+	case share >= p.EasyShare:
+		return "easy"
+	case share <= p.HardShare:
+		return "hard"
+	}
+	return "medium"
+}
+
+// irtLabel — метка по сложности в логитах: доля верных ответов среднего
+// студента (θ = 0) сравнивается с теми же порогами, что и в методе ratio.
+// Так же размечается и числовой ответ ML-сервиса (см. mlPredictor).
+func (p recalcPolicy) irtLabel(b float64) string {
+	return p.label(1 / (1 + math.Exp(b)))
+}
+
+func loadRecalcPolicy(q queryer) (recalcPolicy, error) {
+	var p recalcPolicy
+	err := q.QueryRow(`
+        SELECT method, min_answers, easy_share, hard_share, schedule FROM difficulty_policy
+    `).Scan(&p.Method, &p.MinAnswers, &p.EasyShare, &p.HardShare, &p.Schedule)
+	if err == sql.ErrNoRows {
+		return defaultRecalcPolicy, nil
+	}
+	return p, err
+}
+
+// difficultyChange — изменение одного вопроса при пересчёте. Для метода irt
+// сюда попадают и вопросы, у которых сдвинулась только числовая сложность.
+type difficultyChange struct {
+	QuestionID    int64    `json:"question_id"`
+	QuestionText  string   `json:"question_text"`
+	Answers       int64    `json:"answers"`
+	OldDifficulty string   `json:"old_difficulty"`
+	NewDifficulty string   `json:"new_difficulty"`
+	Share         *float64 `json:"share,omitempty"` // доля верных ответов (ratio)
+	OldIRT        *float64 `json:"old_irt_difficulty,omitempty"`
+	NewIRT        *float64 `json:"new_irt_difficulty,omitempty"`
+	oldSE         *float64
+}
+
+// recalcResult — итог пересчёта; при dry run ничего не записано и RunID = 0
+type recalcResult struct {
+	RunID   int                `json:"run_id,omitempty"`
+	DryRun  bool               `json:"dry_run"`
+	Policy  recalcPolicy       `json:"policy"`
+	Changed int                `json:"changed"` // вопросов со сменой метки
+	Changes []difficultyChange `json:"changes"`
+}
+
+// planRatio — метки по доле верных ответов у вопросов с не менее MinAnswers ответами
+func planRatio(q queryer, p recalcPolicy) ([]difficultyChange, error) {
+	rows, err := q.Query(`
+        SELECT q.id, q.question_text, COALESCE(q.difficulty, ''), s.n, s.share
+          FROM questions q
+          JOIN (SELECT question_id, COUNT(*) AS n,
+                       AVG(CASE WHEN is_correct THEN 1.0 ELSE 0 END)::float8 AS share
+                  FROM user_question_answers
+                 GROUP BY question_id
+                HAVING COUNT(*) >= $1) s ON s.question_id = q.id
+         ORDER BY q.id
+    `, p.MinAnswers)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
-
+	changes := []difficultyChange{}
 	for rows.Next() {
-		var id int
-		var text string
-		if err := rows.Scan(&id, &text); err != nil {
-			log.Println("Ошибка чтения вопроса:", err)
+		var (
+			c     difficultyChange
+			share float64
+		)
+		if err := rows.Scan(&c.QuestionID, &c.QuestionText, &c.OldDifficulty, &c.Answers, &share); err != nil {
+			return nil, err
+		}
+		c.NewDifficulty = p.label(share)
+		if c.NewDifficulty == c.OldDifficulty {
 			continue
 		}
+		share = round3(share)
+		c.Share = &share
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
 
-		diff, err := predictDifficulty(text)
-		if err != nil {
-			log.Println("Ошибка предсказания сложности для вопроса", id, ":", err)
-			continue
+// planIRT — калибровка и изменения относительно сохранённых параметров
+func planIRT(q queryer, p recalcPolicy) ([]difficultyChange, irtEstimate, error) {
+	changes := []difficultyChange{}
+	est, err := estimateRasch(q)
+	if err != nil || len(est.questionIDs) == 0 {
+		return changes, est, err
+	}
+
+	type stored struct {
+		text, difficulty string
+		irt, se          *float64
+	}
+	current := map[int64]stored{}
+	rows, err := q.Query(`
+        SELECT id, question_text, COALESCE(difficulty, ''), irt_difficulty, irt_se
+          FROM questions WHERE id = ANY($1)
+    `, pq.Array(est.questionIDs))
+	if err != nil {
+		return nil, est, err
+	}
+	for rows.Next() {
+		var (
+			id      int64
+			s       stored
+			irt, se sql.NullFloat64
+		)
+		if err := rows.Scan(&id, &s.text, &s.difficulty, &irt, &se); err != nil {
+			rows.Close()
+			return nil, est, err
+		}
+		if irt.Valid {
+			s.irt = &irt.Float64
+		}
+		if se.Valid {
+			s.se = &se.Float64
 		}
+		current[id] = s
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, est, err
+	}
 
-		_, err = db.Exec(`UPDATE questions SET difficulty = $1 WHERE id = $2`, diff, id)
-		if err != nil {
-			log.Println("Ошибка обновления вопроса", id, ":", err)
+	for j, id := range est.questionIDs {
+		cur, ok := current[id]
+		if !ok {
 			continue
 		}
+		c := difficultyChange{
+			QuestionID:    id,
+			QuestionText:  cur.text,
+			Answers:       est.counts[j],
+			OldDifficulty: cur.difficulty,
+			NewDifficulty: cur.difficulty,
+			OldIRT:        cur.irt,
+			NewIRT:        &est.b[j],
+			oldSE:         cur.se,
+		}
+		if est.counts[j] >= int64(p.MinAnswers) {
+			c.NewDifficulty = p.irtLabel(est.b[j])
+		}
+		if c.NewDifficulty == c.OldDifficulty && cur.irt != nil && *cur.irt == est.b[j] {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return changes, est, nil
+}
+
+func nullFloat(v *float64) sql.NullFloat64 {
+	if v == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *v, Valid: true}
+}
+
+// runRecalc пересчитывает сложность по политике p. Без dryRun изменения
+// применяются и записываются в историю (difficulty_recalc_runs/_changes)
+// вместе с прежними значениями, чтобы пересчёт можно было откатить.
+// startedBy = 0 — запуск по расписанию.
+func runRecalc(db *sql.DB, p recalcPolicy, dryRun bool, startedBy int) (recalcResult, error) {
+	res := recalcResult{DryRun: dryRun, Policy: p}
+	if !recalcMu.TryLock() {
+		return res, errRecalcBusy
+	}
+	defer recalcMu.Unlock()
+
+	var (
+		est irtEstimate
+		err error
+	)
+	if p.Method == recalcMethodIRT {
+		res.Changes, est, err = planIRT(db, p)
+	} else {
+		res.Changes, err = planRatio(db, p)
+	}
+	if err != nil {
+		return res, err
+	}
+	for _, c := range res.Changes {
+		if c.NewDifficulty != c.OldDifficulty {
+			res.Changed++
+		}
+	}
+	if dryRun {
+		return res, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return res, err
 	}
+	defer tx.Rollback()
 
-	log.Println("ML-пересчёт сложности завершён.")
+	policyJSON, _ := json.Marshal(p)
+	var by sql.NullInt64
+	if startedBy > 0 {
+		by = sql.NullInt64{Int64: int64(startedBy), Valid: true}
+	}
+	if err := tx.QueryRow(`
+        INSERT INTO difficulty_recalc_runs (method, policy, started_by, changed)
+        VALUES ($1, $2::jsonb, $3, $4) RETURNING id
+    `, p.Method, string(policyJSON), by, res.Changed).Scan(&res.RunID); err != nil {
+		return res, err
+	}
+
+	n := len(res.Changes)
+	var (
+		ids                   = make([]int64, n)
+		answers               = make([]int64, n)
+		oldLabels, newLabels  = make([]string, n), make([]string, n)
+		oldIRT, oldSE, newIRT = make([]sql.NullFloat64, n), make([]sql.NullFloat64, n), make([]sql.NullFloat64, n)
+	)
+	for i, c := range res.Changes {
+		ids[i], answers[i] = c.QuestionID, c.Answers
+		oldLabels[i], newLabels[i] = c.OldDifficulty, c.NewDifficulty
+		oldIRT[i], oldSE[i], newIRT[i] = nullFloat(c.OldIRT), nullFloat(c.oldSE), nullFloat(c.NewIRT)
+	}
+	if _, err := tx.Exec(`
+        INSERT INTO difficulty_recalc_changes
+               (run_id, question_id, answers, old_difficulty, new_difficulty,
+                old_irt_difficulty, old_irt_se, new_irt_difficulty)
+        SELECT $1, v.id, v.n, NULLIF(v.old, ''), NULLIF(v.new, ''), v.old_irt, v.old_se, v.new_irt
+          FROM unnest($2::int[], $3::int[], $4::text[], $5::text[], $6::float8[], $7::float8[], $8::float8[])
+               AS v(id, n, old, new, old_irt, old_se, new_irt)
+    `, res.RunID, pq.Array(ids), pq.Array(answers), pq.Array(oldLabels), pq.Array(newLabels),
+		pq.Array(oldIRT), pq.Array(oldSE), pq.Array(newIRT)); err != nil {
+		return res, err
+	}
+
+	if p.Method == recalcMethodIRT {
+		err = applyIRT(tx, p, est)
+	} else {
+		_, err = tx.Exec(`
+            UPDATE questions q SET difficulty = v.label
+              FROM unnest($1::int[], $2::text[]) AS v(id, label)
+             WHERE q.id = v.id
+        `, pq.Array(ids), pq.Array(newLabels))
+	}
+	if err != nil {
+		return res, err
+	}
+	if err := tx.Commit(); err != nil {
+		return res, err
+	}
+	log.Printf("Пересчёт сложности #%d (%s): изменено меток %d\n", res.RunID, p.Method, res.Changed)
+	return res, nil
+}
+
+// applyIRT сохраняет параметры калибровки всех вопросов и студентов; метка
+// меняется только у вопросов с не менее MinAnswers ответами
+func applyIRT(tx *sql.Tx, p recalcPolicy, est irtEstimate) error {
+	if len(est.questionIDs) == 0 {
+		return nil
+	}
+	labels := make([]string, len(est.questionIDs))
+	for j := range est.questionIDs {
+		if est.counts[j] >= int64(p.MinAnswers) {
+			labels[j] = p.irtLabel(est.b[j])
+		}
+	}
+	if _, err := tx.Exec(`
+        UPDATE questions q
+           SET irt_difficulty    = v.b,
+               irt_se            = v.se,
+               irt_responses     = v.n,
+               irt_calibrated_at = NOW(),
+               difficulty        = COALESCE(NULLIF(v.label, ''), q.difficulty)
+          FROM unnest($1::int[], $2::float8[], $3::float8[], $4::int[], $5::text[])
+               AS v(id, b, se, n, label)
+         WHERE q.id = v.id
+    `, pq.Array(est.questionIDs), pq.Array(est.b), pq.Array(est.se), pq.Array(est.counts), pq.Array(labels)); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+        UPDATE users u
+           SET irt_ability = v.theta
+          FROM unnest($1::int[], $2::float8[]) AS v(id, theta)
+         WHERE u.id = v.id
+    `, pq.Array(est.userIDs), pq.Array(est.theta))
+	return err
+}
+
+// rollbackRecalc возвращает вопросам значения, которые были до пересчёта runID.
+// Вопросы, изменённые после него (вручную или следующим пересчётом), не
+// трогаются и считаются пропущенными. Подготовка студентов не откатывается.
+func rollbackRecalc(db *sql.DB, runID, userID int) (restored, skipped int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var rolledBack sql.NullTime
+	if err := tx.QueryRow(`
+        SELECT rolled_back_at FROM difficulty_recalc_runs WHERE id = $1 FOR UPDATE
+    `, runID).Scan(&rolledBack); err != nil {
+		return 0, 0, err
+	}
+	if rolledBack.Valid {
+		return 0, 0, errRunRolledBack
+	}
+
+	var total int
+	if err := tx.QueryRow(
+		`SELECT COUNT(*) FROM difficulty_recalc_changes WHERE run_id = $1`, runID,
+	).Scan(&total); err != nil {
+		return 0, 0, err
+	}
+	res, err := tx.Exec(`
+        UPDATE questions q
+           SET difficulty     = c.old_difficulty,
+               irt_difficulty = CASE WHEN c.new_irt_difficulty IS NULL THEN q.irt_difficulty ELSE c.old_irt_difficulty END,
+               irt_se         = CASE WHEN c.new_irt_difficulty IS NULL THEN q.irt_se ELSE c.old_irt_se END
+          FROM difficulty_recalc_changes c
+         WHERE c.run_id = $1 AND q.id = c.question_id
+           AND q.difficulty IS NOT DISTINCT FROM c.new_difficulty
+           AND (c.new_irt_difficulty IS NULL OR q.irt_difficulty IS NOT DISTINCT FROM c.new_irt_difficulty)
+    `, runID)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, _ := res.RowsAffected()
+	restored = int(n)
+
+	if _, err := tx.Exec(`
+        UPDATE difficulty_recalc_runs SET rolled_back_at = NOW(), rolled_back_by = $2 WHERE id = $1
+    `, runID, userID); err != nil {
+		return 0, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return restored, total - restored, nil
+}
+
+// RecalcDifficulty — плановый пересчёт сложности по текущей политике
+func RecalcDifficulty(db *sql.DB) error {
+	p, err := loadRecalcPolicy(db)
+	if err != nil {
+		return err
+	}
+	_, err = runRecalc(db, p, false, 0)
+	return err
+}
+
+// scheduleRecalc ставит (или переставляет) ночной пересчёт на расписание schedule
+func scheduleRecalc(schedule string) error {
+	recalcScheduleMu.Lock()
+	defer recalcScheduleMu.Unlock()
+	id, err := recalcCron.AddFunc(schedule, func() {
+		log.Println("Автоматический пересчёт сложности вопросов...")
+		if err := RecalcDifficulty(db); err != nil {
+			log.Println("Ошибка при автоматическом пересчёте:", err)
+		} else {
+			log.Println("Пересчёт сложности завершён успешно.")
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if recalcEntry != 0 {
+		recalcCron.Remove(recalcEntry)
+	}
+	recalcEntry = id
 	return nil
 }
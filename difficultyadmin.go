@@ -0,0 +1,310 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recalcRun — запись истории пересчётов
+type recalcRun struct {
+	ID           int                `json:"id"`
+	Method       string             `json:"method"`
+	Policy       json.RawMessage    `json:"policy"`
+	StartedBy    *int               `json:"started_by"` // nil — запуск по расписанию
+	Changed      int                `json:"changed"`
+	CreatedAt    time.Time          `json:"created_at"`
+	RolledBackAt *time.Time         `json:"rolled_back_at"`
+	Changes      []difficultyChange `json:"changes,omitempty"`
+}
+
+func scanRecalcRun(row interface{ Scan(...interface{}) error }) (recalcRun, error) {
+	var (
+		run        recalcRun
+		policy     []byte
+		startedBy  sql.NullInt64
+		rolledBack sql.NullTime
+	)
+	if err := row.Scan(&run.ID, &run.Method, &policy, &startedBy, &run.Changed, &run.CreatedAt, &rolledBack); err != nil {
+		return run, err
+	}
+	run.Policy = policy
+	if startedBy.Valid {
+		id := int(startedBy.Int64)
+		run.StartedBy = &id
+	}
+	if rolledBack.Valid {
+		run.RolledBackAt = &rolledBack.Time
+	}
+	return run, nil
+}
+
+const recalcRunColumns = `id, method, policy, started_by, changed, created_at, rolled_back_at`
+
+func loadRecalcRun(q queryer, runID int) (recalcRun, error) {
+	run, err := scanRecalcRun(q.QueryRow(
+		`SELECT `+recalcRunColumns+` FROM difficulty_recalc_runs WHERE id = $1`, runID,
+	))
+	if err != nil {
+		return run, err
+	}
+	rows, err := q.Query(`
+        SELECT c.question_id, q.question_text, c.answers,
+               COALESCE(c.old_difficulty, ''), COALESCE(c.new_difficulty, ''),
+               c.old_irt_difficulty, c.new_irt_difficulty
+          FROM difficulty_recalc_changes c
+          JOIN questions q ON q.id = c.question_id
+         WHERE c.run_id = $1
+         ORDER BY c.question_id
+    `, runID)
+	if err != nil {
+		return run, err
+	}
+	defer rows.Close()
+	run.Changes = []difficultyChange{}
+	for rows.Next() {
+		var (
+			c              difficultyChange
+			oldIRT, newIRT sql.NullFloat64
+		)
+		if err := rows.Scan(&c.QuestionID, &c.QuestionText, &c.Answers,
+			&c.OldDifficulty, &c.NewDifficulty, &oldIRT, &newIRT); err != nil {
+			return run, err
+		}
+		if oldIRT.Valid {
+			c.OldIRT = &oldIRT.Float64
+		}
+		if newIRT.Valid {
+			c.NewIRT = &newIRT.Float64
+		}
+		run.Changes = append(run.Changes, c)
+	}
+	return run, rows.Err()
+}
+
+// adminDifficultyHandler — управление пересчётом сложности:
+//
+//	GET|PUT /api/admin/difficulty/policy             — политика пересчёта
+//	POST    /api/admin/difficulty/recalc?dry_run=1   — пересчитать сейчас (dry_run — только показать изменения)
+//	GET     /api/admin/difficulty/runs               — история пересчётов
+//	GET     /api/admin/difficulty/runs/{id}          — пересчёт с изменёнными вопросами
+//	POST    /api/admin/difficulty/runs/{id}/rollback — откатить пересчёт
+//	POST    /api/admin/difficulty/ml-batches         — поставить ML-пересчёт всех вопросов в очередь (или вернуть идущий)
+//	GET     /api/admin/difficulty/ml-batches/{id}    — прогресс ML-пересчёта
+func adminDifficultyHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/difficulty"), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "policy":
+		recalcPolicyHandler(w, r)
+	case len(parts) == 1 && parts[0] == "recalc":
+		recalcNowHandler(w, r)
+	case parts[0] == "runs":
+		recalcRunsHandler(w, r, parts[1:])
+	case parts[0] == "ml-batches":
+		mlBatchesHandler(w, r, parts[1:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func recalcPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		p, err := loadRecalcPolicy(db)
+		if err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, p)
+
+	case http.MethodPut:
+		// поля, которых нет в запросе, остаются прежними
+		p, err := loadRecalcPolicy(db)
+		if err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Bad JSON", http.StatusBadRequest)
+			return
+		}
+		if err := p.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		adminID, err := currentUserID(getClaims(r.Context()))
+		if err != nil {
+			http.Error(w, "User not found", http.StatusInternalServerError)
+			return
+		}
+		if _, err := db.Exec(`
+            INSERT INTO difficulty_policy (id, method, min_answers, easy_share, hard_share, schedule, updated_at, updated_by)
+            VALUES (true, $1, $2, $3, $4, $5, NOW(), $6)
+            ON CONFLICT (id) DO UPDATE
+               SET method = $1, min_answers = $2, easy_share = $3, hard_share = $4,
+                   schedule = $5, updated_at = NOW(), updated_by = $6
+        `, p.Method, p.MinAnswers, p.EasyShare, p.HardShare, p.Schedule, adminID); err != nil {
+			log.Println("update difficulty_policy error:", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		if err := scheduleRecalc(p.Schedule); err != nil {
+			log.Println("scheduleRecalc error:", err)
+			http.Error(w, "Не удалось перепланировать пересчёт", http.StatusInternalServerError)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, p)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func recalcNowHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run")
+	adminID, err := currentUserID(getClaims(r.Context()))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusInternalServerError)
+		return
+	}
+	p, err := loadRecalcPolicy(db)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	res, err := runRecalc(db, p, dryRun == "1" || dryRun == "true", adminID)
+	if err == errRecalcBusy {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Println("runRecalc error:", err)
+		http.Error(w, "Ошибка пересчёта сложности", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, res)
+}
+
+func recalcRunsHandler(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) == 0 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rows, err := db.Query(`SELECT ` + recalcRunColumns + ` FROM difficulty_recalc_runs ORDER BY id DESC LIMIT 100`)
+		if err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+		runs := []recalcRun{}
+		for rows.Next() {
+			run, err := scanRecalcRun(rows)
+			if err != nil {
+				http.Error(w, "DB error", http.StatusInternalServerError)
+				return
+			}
+			runs = append(runs, run)
+		}
+		respondWithJSON(w, http.StatusOK, runs)
+		return
+	}
+
+	runID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid run ID", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		run, err := loadRecalcRun(db, runID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Run not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("loadRecalcRun error:", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, run)
+
+	case len(parts) == 2 && parts[1] == "rollback" && r.Method == http.MethodPost:
+		adminID, err := currentUserID(getClaims(r.Context()))
+		if err != nil {
+			http.Error(w, "User not found", http.StatusInternalServerError)
+			return
+		}
+		restored, skipped, err := rollbackRecalc(db, runID, adminID)
+		switch {
+		case err == sql.ErrNoRows:
+			http.Error(w, "Run not found", http.StatusNotFound)
+		case err == errRunRolledBack:
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			log.Println("rollbackRecalc error:", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+		default:
+			// skipped — вопросы, изменённые после этого пересчёта
+			respondWithJSON(w, http.StatusOK, map[string]int{"restored": restored, "skipped": skipped})
+		}
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func mlBatchesHandler(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		adminID, err := currentUserID(getClaims(r.Context()))
+		if err != nil {
+			http.Error(w, "User not found", http.StatusInternalServerError)
+			return
+		}
+		batchID, created, err := enqueueMLBatch(db, adminID)
+		if err != nil {
+			log.Println("enqueueMLBatch error:", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		batch, err := loadDifficultyBatch(db, batchID)
+		if err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		// пересчёт уже идёт — отдаём его прогресс вместо новой пачки
+		status := http.StatusAccepted
+		if !created {
+			status = http.StatusOK
+		}
+		respondWithJSON(w, status, batch)
+
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		batchID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			http.Error(w, "Invalid batch ID", http.StatusBadRequest)
+			return
+		}
+		batch, err := loadDifficultyBatch(db, batchID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Batch not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("loadDifficultyBatch error:", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, batch)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
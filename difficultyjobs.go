@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Очередь предсказания сложности: задания хранятся в difficulty_jobs и
+// разбираются пулом воркеров. Новые и изменённые вопросы сохраняются сразу
+// с difficulty = 'pending' и получают метку, когда воркер дойдёт до задания.
+// Массовый ML-пересчёт ставит задания пачкой (difficulty_batches) в ту же
+// очередь, поэтому к ML-сервису одновременно идёт не больше difficultyWorkers
+// запросов, а одиночные задания из редактора обрабатываются раньше пачек.
+
+const (
+	difficultyPending = "pending"
+
+	difficultyWorkers    = 4
+	difficultyJobTimeout = 15 * time.Second
+	// после стольких неудачных попыток задание пачки помечается failed, а
+	// задание из редактора получает запасную (эвристическую) оценку
+	difficultyJobAttempts = 3
+	difficultyRetryDelay  = 30 * time.Second
+	difficultyIdlePoll    = 5 * time.Second
+	// задание в статусе running дольше этого считается брошенным (воркер упал)
+	difficultyJobStale = 5 * time.Minute
+)
+
+// Статусы заданий
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// difficultyJobsWake будит воркеры сразу после постановки задания, не дожидаясь опроса
+var difficultyJobsWake = make(chan struct{}, 1)
+
+func wakeDifficultyWorkers() {
+	select {
+	case difficultyJobsWake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueDifficultyJob ставит предсказание для вопроса; если для него уже
+// есть задание в очереди, второе не создаётся. Вызывающий будит воркеры
+// после коммита (wakeDifficultyWorkers).
+func enqueueDifficultyJob(q queryer, questionID int) error {
+	_, err := q.Exec(`
+        INSERT INTO difficulty_jobs (question_id)
+        SELECT $1
+         WHERE NOT EXISTS (SELECT 1 FROM difficulty_jobs
+                            WHERE question_id = $1 AND status = 'queued' AND batch_id IS NULL)
+    `, questionID)
+	return err
+}
+
+// difficultyBatch — прогресс массового пересчёта
+type difficultyBatch struct {
+	ID         int        `json:"id"`
+	Total      int        `json:"total"`
+	Queued     int        `json:"queued"`
+	Running    int        `json:"running"`
+	Done       int        `json:"done"`
+	Failed     int        `json:"failed"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at"` // nil, пока есть незавершённые задания
+}
+
+// enqueueMLBatch ставит в очередь предсказание для всех вопросов.
+// createdBy = 0 — запуск без пользователя (из кода или по расписанию).
+// Пока предыдущая пачка не разобрана, новая не создаётся: возвращается
+// ID активной пачки и created = false.
+func enqueueMLBatch(db *sql.DB, createdBy int) (batchID int, created bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	// два одновременных запуска не должны оба не найти активную пачку
+	if _, err := tx.Exec(`LOCK TABLE difficulty_batches IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return 0, false, err
+	}
+	err = tx.QueryRow(`
+        SELECT batch_id FROM difficulty_jobs
+         WHERE batch_id IS NOT NULL AND status IN ('queued', 'running')
+         ORDER BY batch_id
+         LIMIT 1
+    `).Scan(&batchID)
+	if err == nil {
+		return batchID, false, nil
+	} else if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+
+	var by sql.NullInt64
+	if createdBy > 0 {
+		by = sql.NullInt64{Int64: int64(createdBy), Valid: true}
+	}
+	if err := tx.QueryRow(
+		`INSERT INTO difficulty_batches (created_by) VALUES ($1) RETURNING id`, by,
+	).Scan(&batchID); err != nil {
+		return 0, false, err
+	}
+	res, err := tx.Exec(`
+        INSERT INTO difficulty_jobs (question_id, batch_id)
+        SELECT id, $1 FROM questions ORDER BY id
+    `, batchID)
+	if err != nil {
+		return 0, false, err
+	}
+	total, _ := res.RowsAffected()
+	if _, err := tx.Exec(`UPDATE difficulty_batches SET total = $2 WHERE id = $1`, batchID, total); err != nil {
+		return 0, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+	wakeDifficultyWorkers()
+	log.Printf("ML-пересчёт сложности #%d: в очереди %d вопросов\n", batchID, total)
+	return batchID, true, nil
+}
+
+func loadDifficultyBatch(q queryer, batchID int) (difficultyBatch, error) {
+	b := difficultyBatch{ID: batchID}
+	err := q.QueryRow(`
+        SELECT b.total, b.created_at,
+               COUNT(j.id) FILTER (WHERE j.status = 'queued'),
+               COUNT(j.id) FILTER (WHERE j.status = 'running'),
+               COUNT(j.id) FILTER (WHERE j.status = 'done'),
+               COUNT(j.id) FILTER (WHERE j.status = 'failed'),
+               MAX(j.finished_at)
+          FROM difficulty_batches b
+          LEFT JOIN difficulty_jobs j ON j.batch_id = b.id
+         WHERE b.id = $1
+         GROUP BY b.id
+    `, batchID).Scan(&b.Total, &b.CreatedAt, &b.Queued, &b.Running, &b.Done, &b.Failed, &b.FinishedAt)
+	if err != nil {
+		return b, err
+	}
+	if b.Queued+b.Running > 0 {
+		b.FinishedAt = nil
+	}
+	return b, nil
+}
+
+// RecalcDifficultyML ставит массовый ML-пересчёт сложности в очередь
+func RecalcDifficultyML(db *sql.DB) error {
+	_, _, err := enqueueMLBatch(db, 0)
+	return err
+}
+
+// difficultyJob — задание, взятое воркером
+type difficultyJob struct {
+	id, questionID, attempts int
+	batch                    bool
+}
+
+// claimDifficultyJob забирает следующее задание; SKIP LOCKED позволяет
+// воркерам (и нескольким экземплярам сервера) не мешать друг другу
+func claimDifficultyJob(db *sql.DB) (*difficultyJob, error) {
+	var (
+		job     difficultyJob
+		batchID sql.NullInt64
+	)
+	err := db.QueryRow(`
+        UPDATE difficulty_jobs
+           SET status = 'running', started_at = NOW(), attempts = attempts + 1
+         WHERE id = (
+               SELECT id FROM difficulty_jobs
+                WHERE (status = 'queued' AND run_after <= NOW())
+                   OR (status = 'running' AND started_at < NOW() - $1::float8 * INTERVAL '1 second')
+                ORDER BY batch_id NULLS FIRST, id
+                LIMIT 1
+                  FOR UPDATE SKIP LOCKED)
+        RETURNING id, question_id, attempts, batch_id
+    `, difficultyJobStale.Seconds()).Scan(&job.id, &job.questionID, &job.attempts, &batchID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	job.batch = batchID.Valid
+	return &job, nil
+}
+
+// processDifficultyJob предсказывает сложность и записывает результат.
+// Если за время работы вопрос снова изменили (есть новое задание в очереди),
+// результат отбрасывается — метку поставит следующее задание. Задание из
+// редактора не перезаписывает метку, которую преподаватель успел задать вручную.
+func processDifficultyJob(db *sql.DB, job *difficultyJob) {
+	var in DifficultyInput
+	err := db.QueryRow(`
+        SELECT question_text, COALESCE(question_type, ''), set_definitions FROM questions WHERE id = $1
+    `, job.questionID).Scan(&in.Text, &in.Type, &in.Sets)
+	if err == sql.ErrNoRows {
+		// вопрос удалён — задание удаляется вместе с ним (ON DELETE CASCADE)
+		return
+	} else if err != nil {
+		finishDifficultyJob(db, job, err)
+		return
+	}
+
+	// Пока есть попытки, спрашиваем только ML-сервис; на последней попытке
+	// вопрос из редактора получает запасную оценку, чтобы не остаться pending
+	predictor := difficultyPredictor
+	if m, ok := predictor.(*mlPredictor); ok && (job.batch || job.attempts < difficultyJobAttempts) {
+		predictor = m.withoutFallback()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), difficultyJobTimeout)
+	diff, err := predictor.Predict(ctx, in)
+	cancel()
+	if err != nil {
+		finishDifficultyJob(db, job, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		finishDifficultyJob(db, job, err)
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`
+        UPDATE questions SET difficulty = $2
+         WHERE id = $1
+           AND ($3 OR difficulty = 'pending')
+           AND NOT EXISTS (SELECT 1 FROM difficulty_jobs
+                            WHERE question_id = $1 AND status = 'queued' AND batch_id IS NULL)
+    `, job.questionID, diff, job.batch); err != nil {
+		finishDifficultyJob(db, job, err)
+		return
+	}
+	if _, err := tx.Exec(`
+        UPDATE difficulty_jobs SET status = 'done', finished_at = NOW(), last_error = NULL WHERE id = $1
+    `, job.id); err != nil {
+		finishDifficultyJob(db, job, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		finishDifficultyJob(db, job, err)
+	}
+}
+
+// finishDifficultyJob откладывает задание после ошибки или, когда попытки
+// кончились, помечает его failed
+func finishDifficultyJob(db *sql.DB, job *difficultyJob, cause error) {
+	log.Printf("Задание сложности #%d (вопрос %d), попытка %d: %v\n", job.id, job.questionID, job.attempts, cause)
+	status := jobQueued
+	if job.attempts >= difficultyJobAttempts {
+		status = jobFailed
+	}
+	if _, err := db.Exec(`
+        UPDATE difficulty_jobs
+           SET status = $2, last_error = $3,
+               run_after = NOW() + $4::float8 * INTERVAL '1 second',
+               finished_at = CASE WHEN $2 = 'failed' THEN NOW() END
+         WHERE id = $1
+    `, job.id, status, cause.Error(), (difficultyRetryDelay * time.Duration(job.attempts)).Seconds()); err != nil {
+		log.Println("finishDifficultyJob error:", err)
+	}
+}
+
+// startDifficultyWorkers запускает пул воркеров очереди
+func startDifficultyWorkers(db *sql.DB, n int) {
+	for i := 0; i < n; i++ {
+		go func() {
+			for {
+				job, err := claimDifficultyJob(db)
+				if err != nil {
+					log.Println("claimDifficultyJob error:", err)
+				}
+				if job == nil {
+					select {
+					case <-difficultyJobsWake:
+					case <-time.After(difficultyIdlePoll):
+					}
+					continue
+				}
+				// в очереди может быть ещё работа — будим следующий свободный воркер
+				wakeDifficultyWorkers()
+				processDifficultyJob(db, job)
+			}
+		}()
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gradebook — журнал группы: студенты × тесты курсов преподавателя
+type gradebook struct {
+	GroupID   int             `json:"group_id"`
+	GroupName string          `json:"group_name"`
+	Tests     []gradebookTest `json:"tests"`
+	Students  []gradebookRow  `json:"students"`
+}
+
+type gradebookTest struct {
+	ID            int     `json:"id"`
+	Title         string  `json:"title"`
+	CourseID      int     `json:"course_id"`
+	CourseTitle   string  `json:"course_title"`
+	GradingPolicy string  `json:"grading_policy"`
+	MaxScore      float64 `json:"max_score"`
+}
+
+// gradebookRow — строка журнала; Cells идут в том же порядке, что и gradebook.Tests
+type gradebookRow struct {
+	StudentID int             `json:"student_id"`
+	FullName  string          `json:"full_name"`
+	Email     string          `json:"email"`
+	Cells     []gradebookCell `json:"cells"`
+	Total     float64         `json:"total"` // сумма итоговых оценок
+}
+
+type gradebookCell struct {
+	Grade         *float64   `json:"grade"` // итог по политике пересдач теста
+	BestScore     *float64   `json:"best_score"`
+	Attempts      int        `json:"attempts"`
+	LastAttemptAt *time.Time `json:"last_attempt_at"`
+}
+
+// loadGradebook строит журнал группы по тестам курсов преподавателя
+// (courseID > 0 — только по одному курсу)
+func loadGradebook(q queryer, teacherID, groupID, courseID int) (gradebook, error) {
+	gb := gradebook{GroupID: groupID, Tests: []gradebookTest{}, Students: []gradebookRow{}}
+	if err := q.QueryRow(
+		`SELECT name FROM groups WHERE id = $1 AND teacher_id = $2`, groupID, teacherID,
+	).Scan(&gb.GroupName); err != nil {
+		return gb, err
+	}
+
+	rows, err := q.Query(`
+        SELECT t.id, t.title, c.id, c.title, t.grading_policy,
+               COALESCE((SELECT SUM(points) FROM questions WHERE test_id = t.id), 0)
+          FROM tests t
+          JOIN courses c ON c.id = t.course_id
+         WHERE c.teacher_id = $1 AND ($2 = 0 OR c.id = $2)
+         ORDER BY c.id, t.id
+    `, teacherID, courseID)
+	if err != nil {
+		return gb, err
+	}
+	column := map[int]int{}
+	for rows.Next() {
+		var t gradebookTest
+		if err := rows.Scan(&t.ID, &t.Title, &t.CourseID, &t.CourseTitle, &t.GradingPolicy, &t.MaxScore); err != nil {
+			rows.Close()
+			return gb, err
+		}
+		column[t.ID] = len(gb.Tests)
+		gb.Tests = append(gb.Tests, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return gb, err
+	}
+
+	rows, err = q.Query(`
+        SELECT u.id, u.full_name, u.email
+          FROM users u
+          JOIN student_groups sg ON sg.student_id = u.id
+         WHERE sg.group_id = $1 AND sg.removed_at IS NULL
+         ORDER BY u.full_name, u.id
+    `, groupID)
+	if err != nil {
+		return gb, err
+	}
+	index := map[int]int{}
+	for rows.Next() {
+		row := gradebookRow{Cells: make([]gradebookCell, len(gb.Tests))}
+		if err := rows.Scan(&row.StudentID, &row.FullName, &row.Email); err != nil {
+			rows.Close()
+			return gb, err
+		}
+		index[row.StudentID] = len(gb.Students)
+		gb.Students = append(gb.Students, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return gb, err
+	}
+
+	rows, err = q.Query(`
+        SELECT a.user_id, a.test_id, COUNT(*), MAX(a.score), MAX(a.finished_at),`+effectiveGradeSQL+`
+          FROM user_test_attempts a
+          JOIN tests t   ON t.id = a.test_id
+          JOIN courses c ON c.id = t.course_id
+          JOIN student_groups sg ON sg.student_id = a.user_id
+                                AND sg.group_id = $2 AND sg.removed_at IS NULL
+         WHERE a.finished_at IS NOT NULL
+           AND c.teacher_id = $1 AND ($3 = 0 OR c.id = $3)
+         GROUP BY a.user_id, a.test_id, t.grading_policy
+    `, teacherID, groupID, courseID)
+	if err != nil {
+		return gb, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			userID, testID int
+			cell           gradebookCell
+			best, grade    float64
+			last           time.Time
+		)
+		if err := rows.Scan(&userID, &testID, &cell.Attempts, &best, &last, &grade); err != nil {
+			return gb, err
+		}
+		i, ok1 := index[userID]
+		j, ok2 := column[testID]
+		if !ok1 || !ok2 {
+			continue
+		}
+		grade = math.Round(grade*100) / 100
+		cell.BestScore, cell.Grade, cell.LastAttemptAt = &best, &grade, &last
+		gb.Students[i].Cells[j] = cell
+		gb.Students[i].Total += grade
+	}
+	return gb, rows.Err()
+}
+
+// table — журнал в виде таблицы для выгрузки: по три столбца на тест
+func (gb gradebook) table() [][]interface{} {
+	header := []interface{}{"ФИО", "Email"}
+	for _, t := range gb.Tests {
+		header = append(header,
+			t.Title+" — оценка",
+			t.Title+" — попыток",
+			t.Title+" — последняя попытка",
+		)
+	}
+	header = append(header, "Итого")
+
+	table := [][]interface{}{header}
+	for _, s := range gb.Students {
+		row := []interface{}{s.FullName, s.Email}
+		for _, c := range s.Cells {
+			last := ""
+			if c.LastAttemptAt != nil {
+				last = c.LastAttemptAt.Format("2006-01-02 15:04")
+			}
+			row = append(row, c.Grade, c.Attempts, last)
+		}
+		row = append(row, math.Round(s.Total*100)/100)
+		table = append(table, row)
+	}
+	return table
+}
+
+// csvValue переводит ячейку в строку. Текст, который Excel принял бы за
+// формулу (ФИО, названия тестов задают пользователи), экранируется апострофом;
+// числа не трогаем — отрицательное число не формула.
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case *float64:
+		if v != nil {
+			return strconv.FormatFloat(*v, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// GET /api/teacher/groups/{id}/gradebook?course_id=…&format=json|csv|xlsx
+func getTeacherGroupGradebook(w http.ResponseWriter, r *http.Request, teacherID, groupID int) {
+	courseID := 0
+	if s := r.URL.Query().Get("course_id"); s != "" {
+		var err error
+		if courseID, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "Неверный ID курса", http.StatusBadRequest)
+			return
+		}
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" && format != "xlsx" {
+		http.Error(w, "Формат: json, csv или xlsx", http.StatusBadRequest)
+		return
+	}
+
+	gb, err := loadGradebook(db, teacherID, groupID, courseID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Группа не найдена или нет доступа", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("loadGradebook error:", err)
+		http.Error(w, "Ошибка загрузки журнала", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("gradebook-group-%d.%s", groupID, format)
+	switch format {
+	case "json":
+		respondWithJSON(w, http.StatusOK, gb)
+
+	case "csv":
+		var buf bytes.Buffer
+		// BOM — чтобы Excel открыл UTF-8 с кириллицей без искажений
+		buf.WriteString("\ufeff")
+		cw := csv.NewWriter(&buf)
+		for _, row := range gb.table() {
+			rec := make([]string, len(row))
+			for i, v := range row {
+				rec[i] = csvValue(v)
+			}
+			if err := cw.Write(rec); err != nil {
+				http.Error(w, "Ошибка формирования CSV", http.StatusInternalServerError)
+				return
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			http.Error(w, "Ошибка формирования CSV", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.Write(buf.Bytes())
+
+	case "xlsx":
+		var buf bytes.Buffer
+		if err := writeXLSX(&buf, gb.GroupName, gb.table()); err != nil {
+			log.Println("writeXLSX error:", err)
+			http.Error(w, "Ошибка формирования XLSX", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.Write(buf.Bytes())
+	}
+}
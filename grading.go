@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"strings"
+)
+
+// Порог похожести (в процентах) для открытых ответов — тот же, что раньше
+// использовался на клиенте в compareTextAnswers.
+const openAnswerThreshold = 80
+
+// queryer — общий интерфейс *sql.DB и *sql.Tx, чтобы проверка ответа
+// работала как внутри транзакции, так и без неё.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// answerSubmission — то, что присылает студент: только выбранные варианты
+// или текст ответа, без какой-либо оценки.
+type answerSubmission struct {
+	OptionIDs []int `json:"option_ids"`
+	// OptionPositions — номера выбранных вариантов (с нуля) в том порядке,
+	// в котором их показали попытке; переводятся в OptionIDs до проверки
+	OptionPositions []int  `json:"option_positions"`
+	AnswerText      string `json:"answer_text"`
+}
+
+// gradeResult — итог проверки одного ответа
+type gradeResult struct {
+	IsCorrect bool
+	Feedback  string  // пояснение для студента, например контрпример
+	Points    float64 // начисленные баллы с учётом веса и частичного зачёта
+	MaxPoints float64 // вес вопроса
+	AnswerSet string  // для вопросов типа set — вычисленное множество ответа, например {1, 2, 3}
+	// ReviewStatus — auto или pending, если открытый ответ не совпал
+	// с эталоном и должен попасть в очередь ручной проверки
+	ReviewStatus string
+}
+
+// gradeAnswer проверяет ответ на вопрос по options.is_correct
+// и questions.correct_answer_text (для вопросов типа set — как множество,
+// для тождеств — как равносильное выражение) и начисляет баллы по весу вопроса.
+func gradeAnswer(q queryer, attemptID, questionID int, sub answerSubmission) (gradeResult, error) {
+	var (
+		qType       string
+		multiple    bool
+		rule        string
+		points      float64
+		correctText sql.NullString
+		defs        SetDefinitions
+		tmpl        SetTemplate
+		accepted    AcceptedAnswers
+	)
+	err := q.QueryRow(`
+        SELECT question_type, multiple_choice, scoring_rule, points,
+               correct_answer_text, set_definitions, set_template, accepted_answers
+          FROM questions WHERE id = $1
+    `, questionID).Scan(&qType, &multiple, &rule, &points, &correctText, &defs, &tmpl, &accepted)
+	if err != nil {
+		return gradeResult{}, err
+	}
+
+	// Для шаблонных вопросов проверяем на экземпляре этой попытки
+	if tmpl != nil {
+		seed, err := attemptSeed(q, attemptID)
+		if err != nil {
+			return gradeResult{}, err
+		}
+		if defs, err = tmpl.instantiate(seed, questionID); err != nil {
+			return gradeResult{}, err
+		}
+	}
+
+	var res gradeResult
+	if qType == "closed" {
+		credit, err := gradeClosedAnswer(q, questionID, rule, multiple, sub.OptionIDs)
+		if err != nil {
+			return gradeResult{}, err
+		}
+		res = gradeResult{IsCorrect: credit == 1, Points: credit * points}
+	} else {
+		if res, err = gradeTextAnswer(qType, correctText.String, defs, accepted, sub.AnswerText); err != nil {
+			return gradeResult{}, err
+		}
+		if res.IsCorrect {
+			res.Points = points
+		}
+	}
+	res.Points = math.Round(res.Points*100) / 100
+	res.MaxPoints = points
+	res.ReviewStatus = reviewStatusAuto
+	if isOpenQuestion(qType) && !res.IsCorrect {
+		res.ReviewStatus = reviewStatusPending
+	}
+	return res, nil
+}
+
+// gradeTextAnswer проверяет ответ, записанный текстом: множество,
+// тождество или открытый ответ. Открытый ответ сверяется со списком
+// допустимых (см. openanswers.go), а если список пуст — с correct_answer_text.
+func gradeTextAnswer(qType, correct string, defs SetDefinitions, accepted AcceptedAnswers, answer string) (gradeResult, error) {
+	switch qType {
+	case questionTypeSet:
+		return gradeSetAnswer(defs, correct, answer)
+	case questionTypeIdentity:
+		return gradeIdentityAnswer(correct, answer)
+	}
+	if len(accepted) > 0 {
+		return gradeResult{IsCorrect: accepted.match(answer)}, nil
+	}
+	ok := compareTextAnswers(answer, correct, openAnswerThreshold)
+	return gradeResult{IsCorrect: ok}, nil
+}
+
+// gradeClosedAnswer возвращает долю балла за выбранные варианты
+// по правилу частичного зачёта вопроса (см. scoring.go)
+func gradeClosedAnswer(q queryer, questionID int, rule string, multiple bool, selected []int) (float64, error) {
+	rows, err := q.Query(
+		`SELECT id, is_correct FROM options WHERE question_id = $1`,
+		questionID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	options := map[int]bool{}
+	for rows.Next() {
+		var id int
+		var isCorrect bool
+		if err := rows.Scan(&id, &isCorrect); err != nil {
+			return 0, err
+		}
+		options[id] = isCorrect
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return closedCredit(rule, multiple, options, selected), nil
+}
+
+// compareTextAnswers — серверная версия одноимённой функции из
+// static/questions/script.js: похожесть по расстоянию Левенштейна.
+func compareTextAnswers(userInput, correct string, threshold int) bool {
+	u := []rune(strings.ToLower(strings.TrimSpace(userInput)))
+	c := []rune(strings.ToLower(strings.TrimSpace(correct)))
+	if len(c) == 0 {
+		return false
+	}
+	maxLen := len(u)
+	if len(c) > maxLen {
+		maxLen = len(c)
+	}
+	similarity := (1 - float64(levenshtein(u, c))/float64(maxLen)) * 100
+	return similarity >= float64(threshold)
+}
+
+func levenshtein(a, b []rune) int {
+	if len(a) == 0 {
+		return len(b)
+	}
+	if len(b) == 0 {
+		return len(a)
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j-1]+cost, cur[j-1]+1, prev[j]+1)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// recalcAttemptTotals пересчитывает correct_answers, wrong_answers и score
+// попытки по сохранённым ответам. score — сумма баллов за ответы с учётом
+// весов вопросов и частичного зачёта. Неотвеченные вопросы считаются неверными.
+func recalcAttemptTotals(q queryer, attemptID int) (score float64, correct, wrong int, err error) {
+	err = q.QueryRow(`
+        SELECT
+            COALESCE((SELECT SUM(points) FROM user_question_answers
+                       WHERE attempt_id = a.id), 0),
+            COALESCE((SELECT COUNT(*) FROM user_question_answers
+                       WHERE attempt_id = a.id AND is_correct), 0),
+            (SELECT COUNT(*) FROM questions WHERE test_id = a.test_id)
+          FROM user_test_attempts a
+         WHERE a.id = $1
+    `, attemptID).Scan(&score, &correct, &wrong)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	wrong -= correct
+	if wrong < 0 {
+		wrong = 0
+	}
+
+	_, err = q.Exec(`
+        UPDATE user_test_attempts
+           SET score           = $1,
+               correct_answers = $2,
+               wrong_answers   = $3
+         WHERE id = $4
+    `, score, correct, wrong, attemptID)
+	return score, correct, wrong, err
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -15,6 +16,7 @@ import (
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -934,6 +936,14 @@ func teacherGroupsHandler(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		if path == "" {
 			getTeacherGroups(w, teacherID)
+		} else if idStr, ok := strings.CutSuffix(path, "/gradebook"); ok {
+			// GET /api/teacher/groups/{id}/gradebook — журнал оценок группы
+			id, err := strconv.Atoi(idStr)
+			if err != nil {
+				http.Error(w, "Неверный ID группы", http.StatusBadRequest)
+				return
+			}
+			getTeacherGroupGradebook(w, r, teacherID, id)
 		} else {
 			id, err := strconv.Atoi(path)
 			if err != nil {
@@ -1534,7 +1544,9 @@ func teacherTestsHandler(w http.ResponseWriter, r *http.Request) {
 	// GET /api/teacher/tests — список тестов
 	case http.MethodGet:
 		rows, err := db.Query(`
-			SELECT t.id, t.title, t.description, t.course_id, t.created_at
+			SELECT t.id, t.title, t.description, t.course_id, t.review_policy, t.time_limit,
+			       t.max_attempts, t.attempt_cooldown, t.grading_policy,
+			       t.shuffle_questions, t.shuffle_options, t.created_at
 			FROM tests t
 			JOIN courses c ON c.id = t.course_id
 			WHERE c.teacher_id = $1
@@ -1550,7 +1562,9 @@ func teacherTestsHandler(w http.ResponseWriter, r *http.Request) {
 		for rows.Next() {
 			var t TestInfo
 			if err := rows.Scan(
-				&t.ID, &t.Title, &t.Description, &t.CourseID, &t.CreatedAt,
+				&t.ID, &t.Title, &t.Description, &t.CourseID, &t.ReviewPolicy, &t.TimeLimit,
+				&t.MaxAttempts, &t.AttemptCooldown, &t.GradingPolicy,
+				&t.ShuffleQuestions, &t.ShuffleOptions, &t.CreatedAt,
 			); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -1567,14 +1581,47 @@ func teacherTestsHandler(w http.ResponseWriter, r *http.Request) {
 	// POST /api/teacher/tests — создать новый тест
 	case http.MethodPost:
 		var req struct {
-			Title       string `json:"title"`
-			Description string `json:"description"`
-			CourseID    int    `json:"course_id"`
+			Title            string `json:"title"`
+			Description      string `json:"description"`
+			CourseID         int    `json:"course_id"`
+			ReviewPolicy     string `json:"review_policy"`
+			TimeLimit        int    `json:"time_limit"`
+			MaxAttempts      *int   `json:"max_attempts"` // nil — defaultMaxAttempts
+			AttemptCooldown  int    `json:"attempt_cooldown"`
+			GradingPolicy    string `json:"grading_policy"`
+			ShuffleQuestions bool   `json:"shuffle_questions"`
+			ShuffleOptions   bool   `json:"shuffle_options"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid input", http.StatusBadRequest)
 			return
 		}
+		if req.ReviewPolicy == "" {
+			req.ReviewPolicy = reviewAfterLastAttempt
+		}
+		if req.GradingPolicy == "" {
+			req.GradingPolicy = gradingBest
+		}
+		if !validGradingPolicy(req.GradingPolicy) {
+			http.Error(w, "Invalid grading_policy", http.StatusBadRequest)
+			return
+		}
+		maxAttempts := defaultMaxAttempts
+		if req.MaxAttempts != nil {
+			maxAttempts = *req.MaxAttempts
+		}
+		if !validAttemptSettings(maxAttempts, req.AttemptCooldown) {
+			http.Error(w, "Invalid max_attempts or attempt_cooldown", http.StatusBadRequest)
+			return
+		}
+		if !validReviewPolicy(req.ReviewPolicy) {
+			http.Error(w, "Invalid review_policy", http.StatusBadRequest)
+			return
+		}
+		if !validTimeLimit(req.TimeLimit) {
+			http.Error(w, "Invalid time_limit", http.StatusBadRequest)
+			return
+		}
 		// проверяем, что курс принадлежит учителю
 		var owner int
 		if err := db.QueryRow(
@@ -1586,9 +1633,13 @@ func teacherTestsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		var newID int
 		err := db.QueryRow(
-			`INSERT INTO tests (title, description, course_id)
-			 VALUES ($1,$2,$3) RETURNING id`,
-			req.Title, req.Description, req.CourseID,
+			`INSERT INTO tests (title, description, course_id, review_policy, time_limit,
+			                    max_attempts, attempt_cooldown, grading_policy,
+			                    shuffle_questions, shuffle_options)
+			 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING id`,
+			req.Title, req.Description, req.CourseID, req.ReviewPolicy, req.TimeLimit,
+			maxAttempts, req.AttemptCooldown, req.GradingPolicy,
+			req.ShuffleQuestions, req.ShuffleOptions,
 		).Scan(&newID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -1600,11 +1651,36 @@ func teacherTestsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// PUT /api/teacher/tests — обновить тест
 	case http.MethodPut:
-		var req TestInfo
+		var req struct {
+			TestInfo
+			// nil — настройка не меняется
+			TimeLimit        *int  `json:"time_limit"`
+			MaxAttempts      *int  `json:"max_attempts"`
+			AttemptCooldown  *int  `json:"attempt_cooldown"`
+			ShuffleQuestions *bool `json:"shuffle_questions"`
+			ShuffleOptions   *bool `json:"shuffle_options"`
+		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid input", http.StatusBadRequest)
 			return
 		}
+		if req.ReviewPolicy != "" && !validReviewPolicy(req.ReviewPolicy) {
+			http.Error(w, "Invalid review_policy", http.StatusBadRequest)
+			return
+		}
+		if req.TimeLimit != nil && !validTimeLimit(*req.TimeLimit) {
+			http.Error(w, "Invalid time_limit", http.StatusBadRequest)
+			return
+		}
+		if req.GradingPolicy != "" && !validGradingPolicy(req.GradingPolicy) {
+			http.Error(w, "Invalid grading_policy", http.StatusBadRequest)
+			return
+		}
+		if (req.MaxAttempts != nil && !validAttemptSettings(*req.MaxAttempts, 0)) ||
+			(req.AttemptCooldown != nil && !validAttemptSettings(0, *req.AttemptCooldown)) {
+			http.Error(w, "Invalid max_attempts or attempt_cooldown", http.StatusBadRequest)
+			return
+		}
 		// проверяем владение
 		var ownerID int
 		if err := db.QueryRow(
@@ -1619,9 +1695,18 @@ func teacherTestsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		res, err := db.Exec(
 			`UPDATE tests
-			 SET title=$1, description=$2
-			 WHERE id=$3`,
-			req.Title, req.Description, req.ID,
+			 SET title=$1, description=$2,
+			     review_policy=COALESCE(NULLIF($3, ''), review_policy),
+			     time_limit=COALESCE($5, time_limit),
+			     max_attempts=COALESCE($6, max_attempts),
+			     attempt_cooldown=COALESCE($7, attempt_cooldown),
+			     grading_policy=COALESCE(NULLIF($8, ''), grading_policy),
+			     shuffle_questions=COALESCE($9, shuffle_questions),
+			     shuffle_options=COALESCE($10, shuffle_options)
+			 WHERE id=$4`,
+			req.Title, req.Description, req.ReviewPolicy, req.ID, req.TimeLimit,
+			req.MaxAttempts, req.AttemptCooldown, req.GradingPolicy,
+			req.ShuffleQuestions, req.ShuffleOptions,
 		)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -1714,8 +1799,17 @@ func teacherQuestionsHandler(w http.ResponseWriter, r *http.Request) {
                    question_type,
                    multiple_choice,
                    correct_answer_text,
+                   set_definitions,
+                   set_template,
+                   points,
+                   scoring_rule,
+                   accepted_answers,
                    difficulty,
-                   created_at
+                   created_at,
+                   irt_difficulty,
+                   irt_se,
+                   irt_responses,
+                   irt_calibrated_at
             FROM questions
             WHERE test_id = $1
             ORDER BY created_at
@@ -1729,6 +1823,10 @@ func teacherQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 		var out []QuestionInfoOut
 		for rows.Next() {
 			var q QuestionInfo
+			var accepted AcceptedAnswers
+			var calibrated sql.NullTime
+			var irtB, irtSE sql.NullFloat64
+			var irtN int
 			if err := rows.Scan(
 				&q.ID,
 				&q.TestID,
@@ -1736,16 +1834,34 @@ func teacherQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 				&q.QuestionType,
 				&q.MultipleChoice,
 				&q.CorrectAnswerText,
+				&q.SetDefinitions,
+				&q.SetTemplate,
+				&q.Points,
+				&q.ScoringRule,
+				&accepted,
 				&q.Difficulty,
 				&q.CreatedAt,
+				&irtB,
+				&irtSE,
+				&irtN,
+				&calibrated,
 			); err != nil {
 				log.Println("Scan question error:", err)
 				continue
 			}
-			out = append(out, QuestionInfoOut{
+			qo := QuestionInfoOut{
 				QuestionInfo:      q,
 				CorrectAnswerText: q.CorrectAnswerText.String,
-			})
+				AcceptedAnswers:   accepted,
+				IRTResponses:      irtN,
+			}
+			if irtB.Valid {
+				qo.IRTDifficulty, qo.IRTSE = &irtB.Float64, &irtSE.Float64
+			}
+			if calibrated.Valid {
+				qo.IRTCalibratedAt = &calibrated.Time
+			}
+			out = append(out, qo)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -1770,21 +1886,42 @@ func teacherQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Предсказание сложности
-		diff, err := predictDifficulty(req.QuestionText)
+		if err := validateAnswerKey(req.QuestionType, req.SetDefinitions, req.SetTemplate, req.CorrectAnswerText); err != nil {
+			http.Error(w, "Invalid question: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateAcceptedAnswers(req.QuestionType, req.AcceptedAnswers); err != nil {
+			http.Error(w, "Invalid accepted_answers: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		points := defaultQuestionPoints
+		if req.Points != nil {
+			points = *req.Points
+		}
+		if req.ScoringRule == "" {
+			req.ScoringRule = scoringAllOrNothing
+		}
+		if !validQuestionPoints(points) || !validScoringRule(req.ScoringRule) {
+			http.Error(w, "Invalid points or scoring_rule", http.StatusBadRequest)
+			return
+		}
+
+		// Сложность предсказывается в фоне (см. difficultyjobs.go): вопрос
+		// сохраняется сразу с difficulty = 'pending' вместе с заданием в очереди
+		tx, err := db.Begin()
 		if err != nil {
-			log.Println("ML predict error:", err)
-			http.Error(w, "Failed to predict difficulty", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		defer tx.Rollback()
 
 		// вставляем вместе с correct_answer_text и difficulty
 		var newID int
-		err = db.QueryRow(`
+		err = tx.QueryRow(`
             INSERT INTO questions
-                (test_id, question_text, question_type, multiple_choice, correct_answer_text, difficulty)
+                (test_id, question_text, question_type, multiple_choice, correct_answer_text, set_definitions, set_template, difficulty, points, scoring_rule, accepted_answers)
             VALUES
-                ($1,      $2,            $3,            $4,              $5,                  $6)
+                ($1,      $2,            $3,            $4,              $5,                  $6,              $7,           $8,         $9,     $10,          $11)
             RETURNING id
         `,
 			req.TestID,
@@ -1792,12 +1929,26 @@ func teacherQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 			req.QuestionType,
 			req.MultipleChoice,
 			req.CorrectAnswerText,
-			diff,
+			req.SetDefinitions,
+			req.SetTemplate,
+			difficultyPending,
+			points,
+			req.ScoringRule,
+			req.AcceptedAnswers,
 		).Scan(&newID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if err := enqueueDifficultyJob(tx, newID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		wakeDifficultyWorkers()
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
@@ -1824,35 +1975,59 @@ func teacherQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if err := validateAnswerKey(req.QuestionType, req.SetDefinitions, req.SetTemplate, req.CorrectAnswerText); err != nil {
+			http.Error(w, "Invalid question: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateAcceptedAnswers(req.QuestionType, req.AcceptedAnswers); err != nil {
+			http.Error(w, "Invalid accepted_answers: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if (req.Points != nil && !validQuestionPoints(*req.Points)) ||
+			(req.ScoringRule != "" && !validScoringRule(req.ScoringRule)) {
+			http.Error(w, "Invalid points or scoring_rule", http.StatusBadRequest)
+			return
+		}
+
 		// используем сложность из запроса (если поле осталось пустым — можно дефолтировать)
 		newDiff := req.Difficulty
 		if newDiff == "" {
-			// при отсутствии client-side значения — fall back к ML
-			var errPredict error
-			newDiff, errPredict = predictDifficulty(req.QuestionText)
-			if errPredict != nil {
-				log.Println("ML predict error:", errPredict)
-				http.Error(w, "Failed to predict difficulty", http.StatusInternalServerError)
-				return
-			}
+			// при отсутствии client-side значения — ставим предсказание в очередь
+			newDiff = difficultyPending
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		defer tx.Rollback()
 
 		// обновляем question_text, correct_answer_text и difficulty
-		res, err := db.Exec(`
+		res, err := tx.Exec(`
         UPDATE questions
         SET question_text       = $1,
             question_type       = $2,
             multiple_choice     = $3,
             correct_answer_text = $4,
-            difficulty          = $5
-        WHERE id = $6
+            set_definitions     = $5,
+            set_template        = $6,
+            difficulty          = $7,
+            points              = COALESCE($9, points),
+            scoring_rule        = COALESCE(NULLIF($10, ''), scoring_rule),
+            accepted_answers    = COALESCE($11, accepted_answers)
+        WHERE id = $8
     `,
 			req.QuestionText,
 			req.QuestionType,
 			req.MultipleChoice,
 			req.CorrectAnswerText,
+			req.SetDefinitions,
+			req.SetTemplate,
 			newDiff,
 			req.ID,
+			req.Points,
+			req.ScoringRule,
+			req.AcceptedAnswers,
 		)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -1862,6 +2037,17 @@ func teacherQuestionsHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Question not found", http.StatusNotFound)
 			return
 		}
+		if newDiff == difficultyPending {
+			if err := enqueueDifficultyJob(tx, req.ID); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		wakeDifficultyWorkers()
 		w.WriteHeader(http.StatusNoContent)
 
 	// DELETE /api/teacher/questions
@@ -2056,6 +2242,18 @@ func teacherOptionsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetCourses(w http.ResponseWriter, r *http.Request) {
+	// Доля изученной теории по курсам для текущего пользователя
+	completion := map[int]courseCompletion{}
+	if claims := getClaims(r.Context()); claims != nil {
+		if userID, err := currentUserID(claims); err == nil {
+			if c, err := loadCourseCompletion(db, userID); err != nil {
+				log.Println("GetCourses completion error:", err)
+			} else {
+				completion = c
+			}
+		}
+	}
+
 	// Получаем список курсов
 	rows, err := db.Query("SELECT id, title, description FROM courses")
 	if err != nil {
@@ -2093,6 +2291,10 @@ func GetCourses(w http.ResponseWriter, r *http.Request) {
 			"description": description,
 			"test_count":  testCount,
 		}
+		c := completion[id]
+		course["theory_total"] = c.TheoryTotal
+		course["theory_completed"] = c.TheoryCompleted
+		course["completion_percent"] = c.Percent
 		courses = append(courses, course)
 	}
 
@@ -2140,22 +2342,45 @@ func GetCourseByID(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rowsT.Close()
 
+	// Прогресс текущего пользователя по темам курса
+	states := map[int]theoryState{}
+	if claims := getClaims(r.Context()); claims != nil {
+		if userID, err := currentUserID(claims); err == nil {
+			if st, err := loadTheoryStates(db, userID, id); err != nil {
+				log.Println("Error loading theory progress:", err)
+			} else {
+				states = st
+			}
+		}
+	}
+
 	var theory []map[string]interface{}
+	completed := 0
 	for rowsT.Next() {
 		var tID int
-		var tTitle, tSum, tContent string
-		err = rowsT.Scan(&tID, &tTitle, &tSum, &tContent)
+		var tTitle, tContent string
+		err = rowsT.Scan(&tID, &tTitle, &tContent)
 		if err != nil {
 			http.Error(w, "Error reading theory row", http.StatusInternalServerError)
 			return
 		}
+		st := states[tID]
+		if st.Completed {
+			completed++
+		}
 		theory = append(theory, map[string]interface{}{
-			"id":      tID,
-			"title":   tTitle,
-			"content": tContent, // можно опустить, если не нужен на этом этапе
+			"id":         tID,
+			"title":      tTitle,
+			"content":    tContent, // можно опустить, если не нужен на этом этапе
+			"completed":  st.Completed,
+			"time_spent": st.TimeSpent,
 		})
 
 	}
+	completionPercent := 0.0
+	if len(theory) > 0 {
+		completionPercent = float64(completed*10000/len(theory)) / 100
+	}
 
 	// 3. Тесты
 	rowsQ, err := db.Query(`
@@ -2193,6 +2418,9 @@ func GetCourseByID(w http.ResponseWriter, r *http.Request) {
 		"description": course.Description,
 		"theory":      theory,
 		"tests":       tests,
+
+		"theory_completed":   completed,
+		"completion_percent": completionPercent,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -2275,7 +2503,8 @@ func GetTests(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := db.Query(`
         SELECT t.id, t.title,
-            (SELECT COUNT(*) FROM questions q WHERE q.test_id = t.id) as question_count
+            (SELECT COUNT(*) FROM questions q WHERE q.test_id = t.id) as question_count,
+            t.time_limit, t.max_attempts, t.grading_policy
         FROM tests t
         WHERE t.course_id = $1
         ORDER BY t.id
@@ -2290,12 +2519,15 @@ func GetTests(w http.ResponseWriter, r *http.Request) {
 		ID            int    `json:"id"`
 		Title         string `json:"title"`
 		QuestionCount int    `json:"question_count"`
+		TimeLimit     int    `json:"time_limit"`
+		MaxAttempts   int    `json:"max_attempts"`
+		GradingPolicy string `json:"grading_policy"`
 	}
 
 	var tests []Test
 	for rows.Next() {
 		var t Test
-		if err := rows.Scan(&t.ID, &t.Title, &t.QuestionCount); err != nil {
+		if err := rows.Scan(&t.ID, &t.Title, &t.QuestionCount, &t.TimeLimit, &t.MaxAttempts, &t.GradingPolicy); err != nil {
 			continue
 		}
 		tests = append(tests, t)
@@ -2328,6 +2560,7 @@ func GetTheoryItem(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
 	}
+	recordTheoryView(r, item.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(item)
@@ -2348,7 +2581,7 @@ func GetTestQuestions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 2) Запрашиваем все вопросы этого теста
-	rows, err := db.Query(`SELECT id, test_id, question_text, question_type, multiple_choice, correct_answer_text, created_at, difficulty
+	rows, err := db.Query(`SELECT id, test_id, question_text, question_type, multiple_choice, correct_answer_text, set_definitions, set_template, points, scoring_rule, created_at, difficulty
 		FROM questions
 		WHERE test_id = $1
 		ORDER BY id`, testID)
@@ -2368,6 +2601,10 @@ func GetTestQuestions(w http.ResponseWriter, r *http.Request) {
 			&q.QuestionType,
 			&q.MultipleChoice,
 			&q.CorrectAnswerText,
+			&q.SetDefinitions,
+			&q.SetTemplate,
+			&q.Points,
+			&q.ScoringRule,
 			&q.CreatedAt,
 			&q.Difficulty,
 		); err != nil {
@@ -2405,16 +2642,75 @@ func GetTestQuestions(w http.ResponseWriter, r *http.Request) {
 		questions = append(questions, q)
 	}
 
-	// 4) Формируем выходную структуру
-	var result []QuestionInfoOut
-	for _, q := range questions {
-		result = append(result, QuestionInfoOut{
-			QuestionInfo:      q,
-			CorrectAnswerText: q.CorrectAnswerText.String,
-		})
+	// 4) Решаем, можно ли показывать ключ ответов
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Не авторизован", http.StatusUnauthorized)
+		return
+	}
+	userID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
+	}
+	showKey, err := canSeeAnswerKey(db, claims.Role, userID, testID)
+	if err != nil {
+		log.Println("Review policy error:", err)
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// 5) Отдаём JSON
+	// 5) Множества шаблонных вопросов и порядок — из попытки (?attempt_id=… или текущей)
+	attemptID, _ := strconv.Atoi(r.URL.Query().Get("attempt_id"))
+	attemptID, seed, hasAttempt, err := testAttempt(db, userID, testID, attemptID)
+	if err != nil {
+		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hasAttempt {
+		order, err := loadAttemptOrder(db, attemptID)
+		if err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		questions = applyAttemptOrder(questions, order)
+	}
+	for i := range questions {
+		if questions[i].SetTemplate == nil || !hasAttempt {
+			continue
+		}
+		defs, err := questions[i].SetTemplate.instantiate(seed, questions[i].ID)
+		if err != nil {
+			log.Println("Instantiate template error:", err)
+			continue
+		}
+		questions[i].SetDefinitions = defs
+	}
+
+	// 6) Формируем выходную структуру: полный ключ или очищенный вариант
+	var result interface{}
+	if showKey {
+		var full []QuestionInfoOut
+		for _, q := range questions {
+			out := QuestionInfoOut{
+				QuestionInfo:      q,
+				CorrectAnswerText: q.CorrectAnswerText.String,
+			}
+			if q.QuestionType == questionTypeSet && q.SetDefinitions != nil {
+				out.CorrectSet = correctSet(q.SetDefinitions, q.CorrectAnswerText.String)
+			}
+			full = append(full, out)
+		}
+		result = full
+	} else {
+		var sanitized []StudentQuestionInfo
+		for _, q := range questions {
+			sanitized = append(sanitized, sanitizeQuestion(q))
+		}
+		result = sanitized
+	}
+
+	// 7) Отдаём JSON
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(result); err != nil {
 		log.Println("Encode questions error:", err)
@@ -2439,6 +2735,25 @@ func GetTheoryWithTests(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Не авторизован", http.StatusUnauthorized)
+		return
+	}
+	userID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
+	}
+
+	recordTheoryView(r, theory.ID)
+	theory.Progress = theoryState{TheoryID: theory.ID}
+	if states, err := loadTheoryStates(db, userID, theory.CourseID); err != nil {
+		log.Println("Theory progress error:", err)
+	} else if st, ok := states[theory.ID]; ok {
+		theory.Progress = st
+	}
+
 	// Загружаем тесты по course_id
 	testsRows, err := db.Query(`SELECT id, title, description, created_at FROM tests WHERE course_id = $1`, theory.CourseID)
 	if err != nil {
@@ -2453,6 +2768,13 @@ func GetTheoryWithTests(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
+		// Ключ ответов отдаём только тем, кому он положен по политике теста
+		showKey, err := canSeeAnswerKey(db, claims.Role, userID, test.ID)
+		if err != nil {
+			log.Println("Review policy error:", err)
+			continue
+		}
+
 		// Загружаем вопросы для теста
 		qRows, err := db.Query(`SELECT id, question_text, question_type, multiple_choice, created_at FROM questions WHERE test_id = $1`, test.ID)
 		if err != nil {
@@ -2472,9 +2794,13 @@ func GetTheoryWithTests(w http.ResponseWriter, r *http.Request) {
 			}
 			for oRows.Next() {
 				var option Option
-				if err := oRows.Scan(&option.ID, &option.Text, &option.IsCorrect, &option.CreatedAt); err != nil {
+				var isCorrect bool
+				if err := oRows.Scan(&option.ID, &option.Text, &isCorrect, &option.CreatedAt); err != nil {
 					continue
 				}
+				if showKey {
+					option.IsCorrect = &isCorrect
+				}
 				question.Options = append(question.Options, option)
 			}
 			oRows.Close()
@@ -2516,6 +2842,8 @@ func teacherSetOpenAnswerHandler(w http.ResponseWriter, r *http.Request) {
 	var data struct {
 		ID     int    `json:"id"`
 		Answer string `json:"answer"`
+		// Accepted — список допустимых ответов; отсутствует — без изменений
+		Accepted AcceptedAnswers `json:"accepted_answers"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -2526,13 +2854,16 @@ func teacherSetOpenAnswerHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Проверяем владельца вопроса
 	var owner int
+	var qType string
+	var defs SetDefinitions
+	var tmpl SetTemplate
 	err := db.QueryRow(`
-        SELECT c.teacher_id
+        SELECT c.teacher_id, q.question_type, q.set_definitions, q.set_template
         FROM questions q
         JOIN tests t ON t.id = q.test_id
         JOIN courses c ON c.id = t.course_id
         WHERE q.id = $1
-    `, qid).Scan(&owner)
+    `, qid).Scan(&owner, &qType, &defs, &tmpl)
 	if err != nil {
 		http.Error(w, "Question not found", http.StatusNotFound)
 		return
@@ -2542,12 +2873,24 @@ func teacherSetOpenAnswerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Для вопросов-множеств и тождеств ответ должен разбираться
+	if err := validateAnswerKey(qType, defs, tmpl, answer); err != nil {
+		http.Error(w, "Invalid answer: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateAcceptedAnswers(qType, data.Accepted); err != nil {
+		http.Error(w, "Invalid accepted_answers: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Обновляем ответ
 	if _, err := db.Exec(
 		`UPDATE questions
-           SET correct_answer_text = $1
+           SET correct_answer_text = $1,
+               accepted_answers    = COALESCE($3, accepted_answers)
          WHERE id = $2`,
-		answer, qid,
+		answer, qid, data.Accepted,
 	); err != nil {
 		http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -2767,7 +3110,7 @@ func GetTheoryHandler(w http.ResponseWriter, r *http.Request, id int) {
 	json.NewEncoder(w).Encode(theory)
 }
 
-// SubmitAnswerHandler — сохраняет историю ответа и обновляет попытку
+// SubmitAnswerHandler — проверяет ответ на сервере, сохраняет историю и пересчитывает попытку
 func SubmitAnswerHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -2780,24 +3123,17 @@ func SubmitAnswerHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Не авторизован", http.StatusUnauthorized)
 		return
 	}
-	userID := claims.UserID
-	if userID == 0 {
-		// дополнительный запрос к БД
-		err := db.QueryRow(
-			`SELECT id FROM users WHERE email = $1`,
-			claims.Email,
-		).Scan(&userID)
-		if err != nil {
-			http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
-			return
-		}
+	userID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
 	}
 
-	// Парсим тело
+	// Парсим тело: только выбранные варианты или текст ответа
 	var req struct {
-		QuestionID int  `json:"question_id"`
-		IsCorrect  bool `json:"is_correct"`
-		AttemptID  int  `json:"attempt_id"`
+		QuestionID int `json:"question_id"`
+		AttemptID  int `json:"attempt_id"`
+		answerSubmission
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -2813,50 +3149,138 @@ func SubmitAnswerHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// 1) Вставляем историю ответа
-	_, err = tx.Exec(
-		`INSERT INTO user_question_answers (user_id, question_id, is_correct, attempt_id)
-         VALUES ($1, $2, $3, $4)`,
-		userID, req.QuestionID, req.IsCorrect, req.AttemptID,
+	// 1) Попытка должна принадлежать пользователю и быть незавершённой,
+	//    а вопрос — относиться к тесту этой попытки
+	var (
+		testID  int
+		expired bool
 	)
+	err = tx.QueryRow(`
+        SELECT test_id,
+               COALESCE(deadline_at + make_interval(secs => $3) < NOW(), false)
+          FROM user_test_attempts
+         WHERE id = $1 AND user_id = $2 AND finished_at IS NULL
+           FOR UPDATE
+    `, req.AttemptID, userID, attemptGracePeriod).Scan(&testID, &expired)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Активная попытка не найдена", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("Select attempt error:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// Время вышло — закрываем попытку сразу, не дожидаясь фоновой задачи
+	if expired {
+		if err := closeAttempt(tx, req.AttemptID); err != nil {
+			log.Println("Close expired attempt error:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			log.Println("Commit tx error:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Время на попытку истекло", http.StatusForbidden)
+		return
+	}
+	var questionTestID int
+	err = tx.QueryRow(`SELECT test_id FROM questions WHERE id = $1`, req.QuestionID).Scan(&questionTestID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Вопрос не найден", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("SubmitAnswer question lookup error:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if questionTestID != testID {
+		http.Error(w, "Вопрос не относится к тесту попытки", http.StatusBadRequest)
+		return
+	}
+
+	// Ответ, который уже оценил преподаватель, заменить нельзя: вместе со
+	// строкой пропали бы его оценка и отметка о проверке
+	var reviewed bool
+	if err := tx.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM user_question_answers
+                       WHERE attempt_id = $1 AND question_id = $2 AND review_status = $3)
+    `, req.AttemptID, req.QuestionID, reviewStatusReviewed).Scan(&reviewed); err != nil {
+		log.Println("Check reviewed answer error:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if reviewed {
+		http.Error(w, "Ответ уже проверен преподавателем", http.StatusConflict)
+		return
+	}
+
+	// 2) Номера вариантов в порядке попытки переводим в id и проверяем ответ
+	if len(req.OptionPositions) > 0 {
+		ids, err := optionIDsAtPositions(tx, req.AttemptID, req.QuestionID, req.OptionPositions)
+		if err == errBadOptionPosition {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			log.Println("Resolve option positions error:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		req.OptionIDs = ids
+	}
+	grade, err := gradeAnswer(tx, req.AttemptID, req.QuestionID, req.answerSubmission)
 	if err != nil {
+		log.Println("Grade answer error:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// 2) Обновляем счётчики в активной попытке
-	res, err := tx.Exec(
-		`UPDATE user_test_attempts
-            SET correct_answers = correct_answers + CASE WHEN $3 THEN 1 ELSE 0 END,
-                wrong_answers   = wrong_answers   + CASE WHEN $3 THEN 0 ELSE 1 END
-          WHERE user_id = $1
-            AND    finished_at IS NULL
-            AND    test_id IN (
-                   SELECT test_id FROM questions WHERE id = $2
-                )`,
-		userID, req.QuestionID, req.IsCorrect,
+	// 3) Сохраняем историю ответа (повторный ответ заменяет предыдущий)
+	if _, err := tx.Exec(
+		`DELETE FROM user_question_answers WHERE attempt_id = $1 AND question_id = $2`,
+		req.AttemptID, req.QuestionID,
+	); err != nil {
+		log.Println("Delete previous answer error:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// вместе с оценкой храним сам ответ: варианты, текст и множество
+	_, err = tx.Exec(
+		`INSERT INTO user_question_answers
+             (user_id, question_id, is_correct, attempt_id, points,
+              selected_option_ids, answer_text, answer_set, review_status)
+         VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9)`,
+		userID, req.QuestionID, grade.IsCorrect, req.AttemptID, grade.Points,
+		pq.Array(req.OptionIDs), req.AnswerText, grade.AnswerSet, grade.ReviewStatus,
 	)
 	if err != nil {
-		log.Println("Update user_test_attempts error:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	// Optional: проверить, что строка действительно обновилась
-	if count, _ := res.RowsAffected(); count == 0 {
-		log.Println("No active user_test_attempts row to update")
+
+	// 4) Пересчитываем счётчики попытки
+	if _, _, _, err := recalcAttemptTotals(tx, req.AttemptID); err != nil {
+		log.Println("Update user_test_attempts error:", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
 
-	// 3) Коммитим
+	// 5) Коммитим
 	if err := tx.Commit(); err != nil {
 		log.Println("Commit tx error:", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// 4) Возвращаем подтверждение с краткой статистикой (по желанию)
+	// 6) Возвращаем подтверждение, результат проверки и пояснение
 	resp := struct {
-		Message string `json:"message"`
-	}{"Answer recorded"}
+		Message   string  `json:"message"`
+		IsCorrect bool    `json:"is_correct"`
+		Points    float64 `json:"points"`
+		MaxPoints float64 `json:"max_points"`
+		Feedback  string  `json:"feedback,omitempty"`
+	}{"Answer recorded", grade.IsCorrect, grade.Points, grade.MaxPoints, grade.Feedback}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(resp)
@@ -2887,18 +3311,24 @@ func GetAttemptsCount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var cnt int
-	err = db.QueryRow(
-		`SELECT COUNT(*) FROM user_test_attempts WHERE user_id=$1 AND test_id=$2`,
-		claims.UserID, testID,
-	).Scan(&cnt)
+	userID, err := currentUserID(claims)
 	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
+	}
+
+	// Сколько попыток сделано, сколько осталось и действует ли пауза
+	st, err := loadAttemptStatus(db, userID, testID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Test not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, "DB error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"attemptsDone": cnt})
+	json.NewEncoder(w).Encode(st)
 }
 
 func CreateTestAttempt(w http.ResponseWriter, r *http.Request) {
@@ -2940,13 +3370,78 @@ func CreateTestAttempt(w http.ResponseWriter, r *http.Request) {
 	}
 	// fmt.Printf("CreateTestAttempt: user %d, test %d\n", userID, testID)
 
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "DB insert error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Параллельные запросы одного студента к одному тесту выполняются по очереди,
+	// иначе оба пройдут проверку лимита
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, $2)`, userID, testID); err != nil {
+		http.Error(w, "DB insert error", http.StatusInternalServerError)
+		return
+	}
+
+	// Незавершённая попытка продолжается: новую не создаём, иначе брошенные
+	// попытки расходовали бы лимит
+	open, ok, err := resumableAttempt(tx, userID, testID)
+	if err != nil {
+		log.Println("CreateTestAttempt resume error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if ok {
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		resp := map[string]interface{}{
+			"attemptId":     open.ID,
+			"attemptNumber": open.Number,
+			"resumed":       true,
+		}
+		if open.Deadline.Valid {
+			resp["deadlineAt"] = open.Deadline.Time
+		}
+		respondWithJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	// Лимит попыток и пауза между ними — по настройкам теста
+	if err := checkAttemptAllowed(tx, userID, testID); err != nil {
+		if denied, ok := err.(*attemptDenied); ok {
+			if denied.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(denied.RetryAfter.Seconds())+1))
+			}
+			http.Error(w, denied.Msg, denied.Status)
+			return
+		}
+		log.Println("CreateTestAttempt check error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	// seed определяет экземпляры шаблонных вопросов этой попытки
+	seed := rand.Int63()
+
+	// порядок вопросов и вариантов фиксируется при создании попытки
+	order, err := buildAttemptOrder(tx, testID, seed)
+	if err != nil {
+		log.Println("CreateTestAttempt order error:", err)
+		http.Error(w, "DB insert error", http.StatusInternalServerError)
+		return
+	}
+
 	var attemptID, attemptNumber int
-	err = db.QueryRow(`
+	var deadline sql.NullTime
+	err = tx.QueryRow(`
         INSERT INTO user_test_attempts
             (user_id, test_id,
              started_at, finished_at,
              score, correct_answers,
-             wrong_answers, attempt_number)
+             wrong_answers, attempt_number, seed, deadline_at, question_order)
         VALUES
             ($1, $2,
              NOW(), NULL,
@@ -2954,21 +3449,34 @@ func CreateTestAttempt(w http.ResponseWriter, r *http.Request) {
              0,
              (SELECT COALESCE(MAX(attempt_number),0)+1
                 FROM user_test_attempts
-               WHERE user_id = $1 AND test_id = $2))
-        RETURNING id, attempt_number
-    `, userID, testID).Scan(&attemptID, &attemptNumber)
+               WHERE user_id = $1 AND test_id = $2),
+             $3,
+             (SELECT NOW() + make_interval(mins => time_limit)
+                FROM tests
+               WHERE id = $2 AND time_limit > 0),
+             $4)
+        RETURNING id, attempt_number, deadline_at
+    `, userID, testID, seed, order).Scan(&attemptID, &attemptNumber, &deadline)
 	if err != nil {
 		fmt.Printf("CreateTestAttempt DB insert error: %v\n", err)
 		http.Error(w, "DB insert error", http.StatusInternalServerError)
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB insert error", http.StatusInternalServerError)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]int{
+	resp := map[string]interface{}{
 		"attemptId":     attemptID,
 		"attemptNumber": attemptNumber,
-	})
+	}
+	if deadline.Valid {
+		resp["deadlineAt"] = deadline.Time
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
 }
 
 func FinishTestAttempt(w http.ResponseWriter, r *http.Request) {
@@ -2989,43 +3497,31 @@ func FinishTestAttempt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var payload struct {
-		Score          int `json:"score"`
-		CorrectAnswers int `json:"correct_answers"`
-		WrongAnswers   int `json:"wrong_answers"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
 	claims := getClaims(r.Context())
 	if claims == nil {
 		http.Error(w, "Не авторизован", http.StatusUnauthorized)
 		return
 	}
+	userID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
+	}
 
-	userID := claims.UserID
-	if userID == 0 {
-		// дополнительный запрос к БД
-		err := db.QueryRow(
-			`SELECT id FROM users WHERE email = $1`,
-			claims.Email,
-		).Scan(&userID)
-		if err != nil {
-			http.Error(w, "Не удалось определить ID преподавателя", http.StatusInternalServerError)
-			return
-		}
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "DB update error", http.StatusInternalServerError)
+		return
 	}
+	defer tx.Rollback()
 
-	res, err := db.Exec(`
+	// Итоги считаются только на сервере — тело запроса не используется.
+	// Попытка, завершённая после дедлайна, закрывается временем дедлайна.
+	res, err := tx.Exec(`
         UPDATE user_test_attempts
-           SET finished_at     = NOW(),
-               score           = $1,
-               correct_answers = $2,
-               wrong_answers   = $3
-         WHERE id = $4 AND user_id = $5
-    `, payload.Score, payload.CorrectAnswers, payload.WrongAnswers, attemptID, userID)
+           SET finished_at = LEAST(NOW(), deadline_at)
+         WHERE id = $1 AND user_id = $2 AND finished_at IS NULL
+    `, attemptID, userID)
 	if err != nil {
 		http.Error(w, "DB update error", http.StatusInternalServerError)
 		return
@@ -3034,9 +3530,24 @@ func FinishTestAttempt(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not found or forbidden", http.StatusNotFound)
 		return
 	}
+	score, correct, wrong, err := recalcAttemptTotals(tx, attemptID)
+	if err != nil {
+		log.Println("FinishTestAttempt recalc error:", err)
+		http.Error(w, "DB update error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB update error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":              true,
+		"score":           score,
+		"correct_answers": correct,
+		"wrong_answers":   wrong,
+	})
 }
 
 func GetLatestAttempt(w http.ResponseWriter, r *http.Request) {
@@ -3074,16 +3585,17 @@ func GetLatestAttempt(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Запрос к БД — последняя завершённая попытка
-	var score, attemptNumber int
+	var score float64
+	var attemptID, attemptNumber int
 	err = db.QueryRow(`
-	  SELECT score, attempt_number
+	  SELECT id, score, attempt_number
 	    FROM user_test_attempts
 	   WHERE user_id = $1
 	     AND test_id = $2
 	     AND finished_at IS NOT NULL
 	   ORDER BY started_at DESC
 	   LIMIT 1
-	`, userID, testID).Scan(&score, &attemptNumber)
+	`, userID, testID).Scan(&attemptID, &score, &attemptNumber)
 
 	if err == sql.ErrNoRows {
 		// нет завершённых попыток — возвращаем 204 No Content
@@ -3098,13 +3610,14 @@ func GetLatestAttempt(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Логируем на всякий случай полученные данные
-	log.Printf("GetLatestAttempt: test=%d user=%d -> score=%d attemptNumber=%d",
+	log.Printf("GetLatestAttempt: test=%d user=%d -> score=%v attemptNumber=%d",
 		testID, userID, score, attemptNumber,
 	)
 
 	// Отдать JSON
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"attempt_id":     attemptID, // для разбора: GET /api/attempts/{id}
 		"score":          score,
 		"attempt_number": attemptNumber,
 	})
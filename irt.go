@@ -0,0 +1,167 @@
+package main
+
+import "math"
+
+// Калибровка сложности по модели Раша (1PL IRT): вероятность верного ответа
+// студента с уровнем подготовки θ на вопрос сложности b равна
+// 1 / (1 + e^-(θ - b)). Оба параметра оцениваются совместно по
+// user_question_answers, поэтому вопрос, на который отвечали в основном
+// сильные студенты, не выглядит лёгким только из-за высокой доли верных ответов.
+//
+// Шкала — логиты: 0 соответствует среднему студенту, b = 1 означает, что
+// средний студент отвечает верно с вероятностью ≈ 27%. Метки easy/medium/hard
+// выводятся из этой вероятности по порогам политики (см. recalcPolicy.irtLabel).
+
+const (
+	// априорные N(0, σ²) для θ и b: держат оценки конечными, когда студент
+	// или вопрос ответили/получили все ответы верно или все неверно
+	irtAbilitySigma    = 1.0
+	irtDifficultySigma = 2.0
+	irtMaxIterations   = 200
+	irtTolerance       = 1e-4
+	// ограничение шага Ньютона, чтобы итерации не разлетались на первых шагах
+	irtMaxStep = 1.0
+)
+
+// irtResponse — первый ответ студента на вопрос; индексы — в срезах raschFit
+type irtResponse struct {
+	person, item int
+	correct      bool
+}
+
+// raschFit — совместная оценка θ студентов и b вопросов (JML с априорными
+// распределениями, поочерёдные шаги Ньютона). Возвращает также стандартные
+// ошибки b.
+func raschFit(responses []irtResponse, persons, items int) (theta, b, se []float64) {
+	theta = make([]float64, persons)
+	b = make([]float64, items)
+	se = make([]float64, items)
+	grad := make([]float64, max(persons, items))
+	info := make([]float64, max(persons, items))
+
+	step := func(v, g, h float64) (float64, float64) {
+		d := g / h
+		d = math.Max(-irtMaxStep, math.Min(irtMaxStep, d))
+		return v + d, math.Abs(d)
+	}
+
+	for iter := 0; iter < irtMaxIterations; iter++ {
+		var change float64
+
+		// шаг по θ при фиксированных b
+		for i := 0; i < persons; i++ {
+			grad[i], info[i] = -theta[i]/(irtAbilitySigma*irtAbilitySigma), 1/(irtAbilitySigma*irtAbilitySigma)
+		}
+		for _, r := range responses {
+			p := 1 / (1 + math.Exp(b[r.item]-theta[r.person]))
+			x := 0.0
+			if r.correct {
+				x = 1
+			}
+			grad[r.person] += x - p
+			info[r.person] += p * (1 - p)
+		}
+		for i := 0; i < persons; i++ {
+			var d float64
+			theta[i], d = step(theta[i], grad[i], info[i])
+			change = math.Max(change, d)
+		}
+
+		// шаг по b при фиксированных θ
+		for j := 0; j < items; j++ {
+			grad[j], info[j] = -b[j]/(irtDifficultySigma*irtDifficultySigma), 1/(irtDifficultySigma*irtDifficultySigma)
+		}
+		for _, r := range responses {
+			p := 1 / (1 + math.Exp(b[r.item]-theta[r.person]))
+			x := 0.0
+			if r.correct {
+				x = 1
+			}
+			grad[r.item] += p - x
+			info[r.item] += p * (1 - p)
+		}
+		for j := 0; j < items; j++ {
+			var d float64
+			b[j], d = step(b[j], grad[j], info[j])
+			se[j] = 1 / math.Sqrt(info[j])
+			change = math.Max(change, d)
+		}
+
+		if change < irtTolerance {
+			break
+		}
+	}
+	return theta, b, se
+}
+
+// irtEstimate — результат калибровки: параметры вопросов и студентов
+type irtEstimate struct {
+	questionIDs []int64
+	b, se       []float64
+	counts      []int64 // число учтённых ответов на вопрос
+	userIDs     []int64
+	theta       []float64
+}
+
+// estimateRasch калибрует все вопросы по первым ответам каждого студента на
+// каждый вопрос. Пересдачи дают студенту подсказку, поэтому берём только первый
+// ответ; ответы, ждущие ручной проверки, ещё не оценены.
+func estimateRasch(q queryer) (irtEstimate, error) {
+	var est irtEstimate
+	rows, err := q.Query(`
+        SELECT DISTINCT ON (user_id, question_id) user_id, question_id, is_correct
+          FROM user_question_answers
+         WHERE review_status <> 'pending'
+         ORDER BY user_id, question_id, attempt_id NULLS FIRST, id
+    `)
+	if err != nil {
+		return est, err
+	}
+	defer rows.Close()
+	var (
+		responses []irtResponse
+		personIdx = map[int64]int{}
+		itemIdx   = map[int64]int{}
+	)
+	for rows.Next() {
+		var (
+			userID, questionID int64
+			correct            bool
+		)
+		if err := rows.Scan(&userID, &questionID, &correct); err != nil {
+			return est, err
+		}
+		pi, ok := personIdx[userID]
+		if !ok {
+			pi = len(est.userIDs)
+			personIdx[userID] = pi
+			est.userIDs = append(est.userIDs, userID)
+		}
+		ii, ok := itemIdx[questionID]
+		if !ok {
+			ii = len(est.questionIDs)
+			itemIdx[questionID] = ii
+			est.questionIDs = append(est.questionIDs, questionID)
+		}
+		responses = append(responses, irtResponse{pi, ii, correct})
+	}
+	if err := rows.Err(); err != nil {
+		return est, err
+	}
+	if len(responses) == 0 {
+		return est, nil
+	}
+
+	est.theta, est.b, est.se = raschFit(responses, len(est.userIDs), len(est.questionIDs))
+	est.counts = make([]int64, len(est.questionIDs))
+	for _, r := range responses {
+		est.counts[r.item]++
+	}
+	for j := range est.b {
+		est.b[j], est.se[j] = round3(est.b[j]), round3(est.se[j])
+	}
+	for i := range est.theta {
+		est.theta[i] = round3(est.theta[i])
+	}
+	return est, nil
+}
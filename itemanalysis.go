@@ -0,0 +1,357 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Пороги классического анализа заданий
+const (
+	// доля попыток в верхней и нижней группах для индекса дискриминации
+	extremeGroupShare = 0.27
+	// ниже этого индекса вопрос плохо отделяет сильных студентов от слабых
+	lowDiscrimination = 0.2
+	// слишком лёгкий / слишком трудный вопрос по доле верных ответов
+	tooEasyP = 0.9
+	tooHardP = 0.2
+	// с меньшим числом попыток дискриминацию не считаем
+	minAnalysisAttempts = 5
+)
+
+// Флаги вопроса в отчёте
+const (
+	flagNegativeDiscrimination = "negative_discrimination"
+	flagLowDiscrimination      = "low_discrimination"
+	flagTooEasy                = "too_easy"
+	flagTooHard                = "too_hard"
+)
+
+// itemAnalysis — отчёт по тесту: по строке на вопрос
+type itemAnalysis struct {
+	TestID    int            `json:"test_id"`
+	Attempts  int            `json:"attempts"` // завершённых попыток в выборке
+	MeanScore float64        `json:"mean_score"`
+	Items     []itemStatsOut `json:"items"`
+}
+
+type itemStatsOut struct {
+	QuestionID   int    `json:"question_id"`
+	QuestionText string `json:"question_text"`
+	QuestionType string `json:"question_type"`
+	Difficulty   string `json:"difficulty"`
+	// PValue — доля попыток с верным ответом (неотвеченный вопрос считается неверным)
+	PValue float64 `json:"p_value"`
+	// PointBiserial — корреляция верности ответа с баллом за остальные вопросы
+	PointBiserial *float64 `json:"point_biserial"`
+	// Discrimination — разность долей верных ответов в верхних и нижних 27% попыток
+	Discrimination *float64           `json:"discrimination"`
+	Options        []optionStatsOut   `json:"options,omitempty"`
+	Flags          []string           `json:"flags"`
+	answers        map[int]itemAnswer // attempt_id → ответ
+}
+
+// optionStatsOut — как часто выбирали вариант, в том числе в крайних группах
+type optionStatsOut struct {
+	OptionID   int     `json:"option_id"`
+	OptionText string  `json:"option_text"`
+	IsCorrect  bool    `json:"is_correct"`
+	Chosen     int     `json:"chosen"`
+	Share      float64 `json:"share"`       // доля от всех попыток
+	UpperShare float64 `json:"upper_share"` // доля в верхней группе
+	LowerShare float64 `json:"lower_share"` // доля в нижней группе
+}
+
+type itemAnswer struct {
+	correct  bool
+	points   float64
+	selected []int64
+}
+
+// pearson — коэффициент корреляции; nil, если у одной из величин нет разброса
+func pearson(x, y []float64) *float64 {
+	n := float64(len(x))
+	if n < 2 {
+		return nil
+	}
+	var sx, sy float64
+	for i := range x {
+		sx += x[i]
+		sy += y[i]
+	}
+	mx, my := sx/n, sy/n
+	var cov, vx, vy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return nil
+	}
+	r := math.Round(cov/math.Sqrt(vx*vy)*1000) / 1000
+	return &r
+}
+
+func round3(v float64) float64 { return math.Round(v*1000) / 1000 }
+
+// loadItemAnalysis считает отчёт по завершённым попыткам теста
+func loadItemAnalysis(q queryer, testID int) (itemAnalysis, error) {
+	rep := itemAnalysis{TestID: testID, Items: []itemStatsOut{}}
+
+	// Попытки и их итоговые баллы
+	type attemptTotal struct {
+		id    int
+		score float64
+	}
+	var attempts []attemptTotal
+	rows, err := q.Query(`
+        SELECT id, score FROM user_test_attempts
+         WHERE test_id = $1 AND finished_at IS NOT NULL
+    `, testID)
+	if err != nil {
+		return rep, err
+	}
+	for rows.Next() {
+		var a attemptTotal
+		if err := rows.Scan(&a.id, &a.score); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		attempts = append(attempts, a)
+		rep.MeanScore += a.score
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+	rep.Attempts = len(attempts)
+	if rep.Attempts > 0 {
+		rep.MeanScore = round3(rep.MeanScore / float64(rep.Attempts))
+	}
+
+	// Вопросы теста; вопрос без метки или ещё ждущий предсказания — unknown
+	byID := map[int]*itemStatsOut{}
+	rows, err = q.Query(`
+        SELECT id, question_text, question_type, COALESCE(NULLIF(NULLIF(difficulty, ''), 'pending'), 'unknown')
+          FROM questions WHERE test_id = $1 ORDER BY id
+    `, testID)
+	if err != nil {
+		return rep, err
+	}
+	for rows.Next() {
+		it := itemStatsOut{Flags: []string{}, answers: map[int]itemAnswer{}}
+		if err := rows.Scan(&it.QuestionID, &it.QuestionText, &it.QuestionType, &it.Difficulty); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		rep.Items = append(rep.Items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+	for i := range rep.Items {
+		byID[rep.Items[i].QuestionID] = &rep.Items[i]
+	}
+
+	// Ответы завершённых попыток
+	rows, err = q.Query(`
+        SELECT a.attempt_id, a.question_id, a.is_correct, a.points, a.selected_option_ids
+          FROM user_question_answers a
+          JOIN user_test_attempts t ON t.id = a.attempt_id
+         WHERE t.test_id = $1 AND t.finished_at IS NOT NULL
+    `, testID)
+	if err != nil {
+		return rep, err
+	}
+	for rows.Next() {
+		var (
+			attemptID, questionID int
+			ans                   itemAnswer
+		)
+		if err := rows.Scan(&attemptID, &questionID, &ans.correct, &ans.points, pq.Array(&ans.selected)); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		if it := byID[questionID]; it != nil {
+			it.answers[attemptID] = ans
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+
+	// Варианты закрытых вопросов
+	rows, err = q.Query(`
+        SELECT o.id, o.question_id, o.option_text, o.is_correct
+          FROM options o
+          JOIN questions q ON q.id = o.question_id
+         WHERE q.test_id = $1
+         ORDER BY o.id
+    `, testID)
+	if err != nil {
+		return rep, err
+	}
+	for rows.Next() {
+		var (
+			o   optionStatsOut
+			qid int
+		)
+		if err := rows.Scan(&o.OptionID, &qid, &o.OptionText, &o.IsCorrect); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		if it := byID[qid]; it != nil {
+			it.Options = append(it.Options, o)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+
+	if rep.Attempts == 0 {
+		return rep, nil
+	}
+
+	// Верхняя и нижняя группы по итоговому баллу
+	sort.Slice(attempts, func(i, j int) bool { return attempts[i].score > attempts[j].score })
+	groupSize := int(math.Round(extremeGroupShare * float64(len(attempts))))
+	groupSize = max(groupSize, 1)
+	upper := map[int]bool{}
+	lower := map[int]bool{}
+	for i := 0; i < groupSize; i++ {
+		upper[attempts[i].id] = true
+		lower[attempts[len(attempts)-1-i].id] = true
+	}
+
+	n := float64(len(attempts))
+	for i := range rep.Items {
+		it := &rep.Items[i]
+		var (
+			correct          float64
+			upperOK, lowerOK float64
+			x, y             []float64
+		)
+		chosen := map[int64][3]int{} // вариант → выбрали всего, в верхней, в нижней группе
+		for _, a := range attempts {
+			ans := it.answers[a.id]
+			v := 0.0
+			if ans.correct {
+				v = 1
+				correct++
+				if upper[a.id] {
+					upperOK++
+				}
+				if lower[a.id] {
+					lowerOK++
+				}
+			}
+			x = append(x, v)
+			// балл за остальные вопросы, чтобы сам вопрос не завышал корреляцию
+			y = append(y, a.score-ans.points)
+			for _, oid := range ans.selected {
+				c := chosen[oid]
+				c[0]++
+				if upper[a.id] {
+					c[1]++
+				}
+				if lower[a.id] {
+					c[2]++
+				}
+				chosen[oid] = c
+			}
+		}
+
+		it.PValue = round3(correct / n)
+		for j := range it.Options {
+			o := &it.Options[j]
+			c := chosen[int64(o.OptionID)]
+			o.Chosen = c[0]
+			o.Share = round3(float64(c[0]) / n)
+			o.UpperShare = round3(float64(c[1]) / float64(groupSize))
+			o.LowerShare = round3(float64(c[2]) / float64(groupSize))
+		}
+
+		switch {
+		case it.PValue >= tooEasyP:
+			it.Flags = append(it.Flags, flagTooEasy)
+		case it.PValue <= tooHardP:
+			it.Flags = append(it.Flags, flagTooHard)
+		}
+		if len(attempts) < minAnalysisAttempts {
+			continue
+		}
+		it.PointBiserial = pearson(x, y)
+		d := round3((upperOK - lowerOK) / float64(groupSize))
+		it.Discrimination = &d
+		switch {
+		case d < 0 || (it.PointBiserial != nil && *it.PointBiserial < 0):
+			it.Flags = append(it.Flags, flagNegativeDiscrimination)
+		case d < lowDiscrimination:
+			it.Flags = append(it.Flags, flagLowDiscrimination)
+		}
+	}
+	return rep, nil
+}
+
+// GET /api/teacher/tests/{id}/analysis — анализ заданий теста
+func TestAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/teacher/tests/"), "/"), "/")
+	if len(parts) != 2 || parts[1] != "analysis" {
+		http.NotFound(w, r)
+		return
+	}
+	testID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid test ID", http.StatusBadRequest)
+		return
+	}
+
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	teacherID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusInternalServerError)
+		return
+	}
+	var owner sql.NullInt64
+	err = db.QueryRow(`
+        SELECT c.teacher_id FROM tests t JOIN courses c ON c.id = t.course_id WHERE t.id = $1
+    `, testID).Scan(&owner)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Test not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if claims.Role != "admin" && (!owner.Valid || int(owner.Int64) != teacherID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	rep, err := loadItemAnalysis(db, testID)
+	if err != nil {
+		log.Println("loadItemAnalysis error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, rep)
+}
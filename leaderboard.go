@@ -0,0 +1,332 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Области лидерборда
+const (
+	leaderboardGlobal = "global"
+	leaderboardCourse = "course"
+	leaderboardGroup  = "group"
+	leaderboardTest   = "test"
+)
+
+// leaderboardTTL — сколько живёт посчитанный рейтинг; таблица попыток
+// сканируется не чаще раза в leaderboardTTL на каждую комбинацию параметров
+const leaderboardTTL = time.Minute
+
+// leaderboardCacheSize — сколько рейтингов держит кэш; при переполнении
+// вытесняется тот, что истекает раньше всех
+const leaderboardCacheSize = 500
+
+const (
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 200
+)
+
+// leaderboardEntry — строка рейтинга. Score — сумма лучших результатов
+// по тестам области; при равенстве выше тот, кто набрал их раньше (ReachedAt).
+type leaderboardEntry struct {
+	Rank       int       `json:"rank"`
+	UserID     int       `json:"user_id"`
+	FullName   string    `json:"full_name"`
+	AvatarPath string    `json:"avatar_path,omitempty"`
+	Score      float64   `json:"score"`
+	Tests      int       `json:"tests"` // по скольким тестам есть результат
+	ReachedAt  time.Time `json:"reached_at"`
+}
+
+type leaderboardResponse struct {
+	Scope   string             `json:"scope"`
+	ID      int                `json:"id,omitempty"`
+	Window  string             `json:"window"`
+	Entries []leaderboardEntry `json:"entries"`
+	Me      *leaderboardEntry  `json:"me,omitempty"` // место текущего пользователя, даже если он не попал в entries
+}
+
+// leaderboardCache хранит полные рейтинги по ключу scope/id/window
+var leaderboardCache = struct {
+	sync.Mutex
+	items map[string]cachedLeaderboard
+}{items: map[string]cachedLeaderboard{}}
+
+type cachedLeaderboard struct {
+	entries []leaderboardEntry
+	expires time.Time
+}
+
+// resetLeaderboardCache сбрасывает кэш, например когда пользователь скрылся из рейтинга
+func resetLeaderboardCache() {
+	leaderboardCache.Lock()
+	leaderboardCache.items = map[string]cachedLeaderboard{}
+	leaderboardCache.Unlock()
+}
+
+// windowStart переводит окно (all, week, month) в нижнюю границу finished_at
+func windowStart(window string, now time.Time) (*time.Time, bool) {
+	var from time.Time
+	switch window {
+	case "", "all":
+		return nil, true
+	case "week":
+		from = now.AddDate(0, 0, -7)
+	case "month":
+		from = now.AddDate(0, -1, 0)
+	default:
+		return nil, false
+	}
+	return &from, true
+}
+
+// loadLeaderboard считает рейтинг студентов по лучшим завершённым попыткам.
+// Пользователи с users.leaderboard_opt_out в рейтинг не попадают.
+func loadLeaderboard(q queryer, scope string, id int, from *time.Time) ([]leaderboardEntry, error) {
+	rows, err := q.Query(`
+        WITH best AS (
+            SELECT DISTINCT ON (a.user_id, a.test_id)
+                   a.user_id, a.test_id, a.score, a.finished_at
+              FROM user_test_attempts a
+              JOIN tests t ON t.id = a.test_id
+             WHERE a.finished_at IS NOT NULL
+               AND ($3::timestamp IS NULL OR a.finished_at >= $3)
+               AND (   $1 = 'global'
+                    OR ($1 = 'course' AND t.course_id = $2)
+                    OR ($1 = 'test'   AND t.id = $2)
+                    OR ($1 = 'group'  AND a.user_id IN (
+                            SELECT student_id FROM student_groups
+                             WHERE group_id = $2 AND removed_at IS NULL)))
+             ORDER BY a.user_id, a.test_id, a.score DESC, a.finished_at
+        ), totals AS (
+            SELECT user_id, SUM(score) AS score, COUNT(*) AS tests, MAX(finished_at) AS reached_at
+              FROM best
+             GROUP BY user_id
+        )
+        SELECT RANK() OVER (ORDER BY tt.score DESC, tt.reached_at),
+               u.id, u.full_name, COALESCE(u.avatar_path, ''),
+               tt.score, tt.tests, tt.reached_at
+          FROM totals tt
+          JOIN users u ON u.id = tt.user_id
+         WHERE u.role = 'student' AND NOT u.leaderboard_opt_out
+         ORDER BY 1, u.id
+    `, scope, id, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []leaderboardEntry{}
+	for rows.Next() {
+		var e leaderboardEntry
+		if err := rows.Scan(&e.Rank, &e.UserID, &e.FullName, &e.AvatarPath, &e.Score, &e.Tests, &e.ReachedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// cachedLeaderboardEntries возвращает рейтинг из кэша или считает его заново
+func cachedLeaderboardEntries(scope string, id int, window string) ([]leaderboardEntry, error) {
+	key := fmt.Sprintf("%s/%d/%s", scope, id, window)
+	now := time.Now()
+
+	leaderboardCache.Lock()
+	c, ok := leaderboardCache.items[key]
+	leaderboardCache.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.entries, nil
+	}
+
+	from, _ := windowStart(window, now)
+	entries, err := loadLeaderboard(db, scope, id, from)
+	if err != nil {
+		return nil, err
+	}
+	leaderboardCache.Lock()
+	storeLeaderboard(key, cachedLeaderboard{entries: entries, expires: now.Add(leaderboardTTL)}, now)
+	leaderboardCache.Unlock()
+	return entries, nil
+}
+
+// storeLeaderboard кладёт рейтинг в кэш, удаляя истёкшие записи и не давая
+// кэшу вырасти больше leaderboardCacheSize. Вызывается под leaderboardCache.Lock.
+func storeLeaderboard(key string, c cachedLeaderboard, now time.Time) {
+	items := leaderboardCache.items
+	for k, v := range items {
+		if !now.Before(v.expires) {
+			delete(items, k)
+		}
+	}
+	if _, ok := items[key]; !ok && len(items) >= leaderboardCacheSize {
+		oldest := ""
+		for k, v := range items {
+			if oldest == "" || v.expires.Before(items[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(items, oldest)
+	}
+	items[key] = c
+}
+
+// leaderboardScopeExists проверяет, что курс, группа или тест с таким id есть;
+// иначе каждый несуществующий id занимал бы место в кэше
+func leaderboardScopeExists(q queryer, scope string, id int) (bool, error) {
+	var table string
+	switch scope {
+	case leaderboardCourse:
+		table = "courses"
+	case leaderboardGroup:
+		table = "groups"
+	case leaderboardTest:
+		table = "tests"
+	default:
+		return true, nil
+	}
+	var exists bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = $1)`, id).Scan(&exists)
+	return exists, err
+}
+
+// GET /api/leaderboard?scope=global|course|group|test&id=…&window=all|week|month&limit=…
+func LeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Не авторизован", http.StatusUnauthorized)
+		return
+	}
+
+	qs := r.URL.Query()
+	scope := qs.Get("scope")
+	if scope == "" {
+		scope = leaderboardGlobal
+	}
+	id := 0
+	switch scope {
+	case leaderboardGlobal:
+	case leaderboardCourse, leaderboardGroup, leaderboardTest:
+		var err error
+		if id, err = strconv.Atoi(qs.Get("id")); err != nil || id <= 0 {
+			http.Error(w, "Для этой области нужен id", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Invalid scope", http.StatusBadRequest)
+		return
+	}
+	window := qs.Get("window")
+	if window == "" {
+		window = "all"
+	}
+	if _, ok := windowStart(window, time.Now()); !ok {
+		http.Error(w, "Invalid window", http.StatusBadRequest)
+		return
+	}
+	limit := defaultLeaderboardLimit
+	if s := qs.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxLeaderboardLimit)
+	}
+
+	exists, err := leaderboardScopeExists(db, scope, id)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Область рейтинга не найдена", http.StatusNotFound)
+		return
+	}
+
+	entries, err := cachedLeaderboardEntries(scope, id, window)
+	if err != nil {
+		log.Println("loadLeaderboard error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := leaderboardResponse{Scope: scope, ID: id, Window: window, Entries: entries}
+	if len(entries) > limit {
+		resp.Entries = entries[:limit]
+	}
+	if userID, err := currentUserID(claims); err == nil {
+		for i := range entries {
+			if entries[i].UserID == userID {
+				me := entries[i]
+				resp.Me = &me
+				break
+			}
+		}
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// PrivacyHandler — участие пользователя в лидерборде
+//
+//	GET /api/me/privacy
+//	PUT /api/me/privacy {"leaderboard_opt_out": true}
+func PrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Не авторизован", http.StatusUnauthorized)
+		return
+	}
+	userID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
+	}
+
+	var settings struct {
+		LeaderboardOptOut bool `json:"leaderboard_opt_out"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		err := db.QueryRow(
+			`SELECT leaderboard_opt_out FROM users WHERE id = $1`, userID,
+		).Scan(&settings.LeaderboardOptOut)
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, settings)
+
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+		if _, err := db.Exec(
+			`UPDATE users SET leaderboard_opt_out = $1 WHERE id = $2`,
+			settings.LeaderboardOptOut, userID,
+		); err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		// иначе пользователь остался бы в рейтинге до истечения кэша
+		resetLeaderboardCache()
+		respondWithJSON(w, http.StatusOK, settings)
+
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
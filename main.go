@@ -1,11 +1,8 @@
 package main
 
 import (
-	"bytes"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"mime"
 	"net/http"
@@ -35,32 +32,6 @@ var (
 	profilePath     = "./static/profile"
 )
 
-// predictDifficulty запрашивает сложность вопроса у ML-сервиса.
-func predictDifficulty(text string) (string, error) {
-	payload, _ := json.Marshal(map[string]string{"question_text": text})
-	resp, err := http.Post("http://localhost:5000/predict",
-		"application/json",
-		bytes.NewBuffer(payload),
-	)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	var out struct {
-		Difficulty string `json:"difficulty"`
-		Error      string `json:"error,omitempty"`
-	}
-	if err := json.Unmarshal(body, &out); err != nil {
-		return "", err
-	}
-	if out.Error != "" {
-		return "", fmt.Errorf("ml error: %s", out.Error)
-	}
-	return out.Difficulty, nil
-}
-
 func main() {
 	// Подключаемся к БД
 	psqlInfo := fmt.Sprintf(
@@ -77,6 +48,9 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Накатываем недостающие таблицы и колонки
+	ensureSchema()
+
 	// Создаём начального администратора, если нет
 	createAdminUser()
 
@@ -104,12 +78,38 @@ func main() {
 	apiMux.HandleFunc("/api/upload-avatar", uploadAvatarHandler)
 	apiMux.HandleFunc("/api/remove-avatar", removeAvatarHandler)
 
+	// GET /api/me/feedback, POST /api/me/feedback/read — отзывы преподавателей
+	apiMux.HandleFunc("/api/me/feedback", MyFeedbackHandler)
+	apiMux.HandleFunc("/api/me/feedback/", MyFeedbackHandler)
+	// GET/PUT /api/me/privacy — участие в лидерборде
+	apiMux.HandleFunc("/api/me/privacy", PrivacyHandler)
+	// GET /api/me/progress — прогресс по курсам
+	apiMux.HandleFunc("/api/me/progress", MyProgressHandler)
+
+	// GET /api/leaderboard — рейтинг по лучшим результатам
+	apiMux.Handle(
+		"/api/leaderboard",
+		RequireAnyRole([]string{"student", "teacher", "admin"}, http.HandlerFunc(LeaderboardHandler)),
+	)
+
 	// POST /api/student/answer — запись одиночного ответа
 	apiMux.Handle(
 		"/api/student/answer",
 		RequireAnyRole([]string{"student", "teacher", "admin"}, http.HandlerFunc(SubmitAnswerHandler)),
 	)
 
+	// GET /api/venn — диаграмма Эйлера–Венна для выражения над множествами
+	apiMux.Handle(
+		"/api/venn",
+		RequireAnyRole([]string{"student", "teacher", "admin"}, http.HandlerFunc(VennHandler)),
+	)
+
+	// POST /api/sets/trace — пошаговое вычисление выражения над множествами
+	apiMux.Handle(
+		"/api/sets/trace",
+		RequireAnyRole([]string{"student", "teacher", "admin"}, http.HandlerFunc(SetTraceHandler)),
+	)
+
 	// === только admin ===
 	apiMux.Handle(
 		"/api/admin/users",
@@ -120,6 +120,12 @@ func main() {
 		RequireRole("admin", http.HandlerFunc(adminCoursesHandler)),
 	)
 
+	// политика, запуск, история и откат пересчёта сложности
+	apiMux.Handle(
+		"/api/admin/difficulty/",
+		RequireRole("admin", http.HandlerFunc(adminDifficultyHandler)),
+	)
+
 	// === только admin для работы с группами ===
 	apiMux.Handle(
 		"/api/admin/groups",
@@ -166,6 +172,20 @@ func main() {
 		"/api/teacher/options",
 		RequireAnyRole([]string{"admin", "teacher"}, http.HandlerFunc(teacherOptionsHandler)),
 	)
+	// GET /api/teacher/tests/{id}/analysis — анализ заданий теста
+	apiMux.Handle(
+		"/api/teacher/tests/",
+		RequireAnyRole([]string{"admin", "teacher"}, http.HandlerFunc(TestAnalysisHandler)),
+	)
+	// очередь ручной проверки открытых ответов
+	apiMux.Handle(
+		"/api/teacher/grading",
+		RequireAnyRole([]string{"admin", "teacher"}, http.HandlerFunc(teacherGradingHandler)),
+	)
+	apiMux.Handle(
+		"/api/teacher/grading/",
+		RequireAnyRole([]string{"admin", "teacher"}, http.HandlerFunc(teacherGradingHandler)),
+	)
 
 	// === курсы для всех авторизованных ролей ===
 	apiMux.Handle(
@@ -205,6 +225,9 @@ func main() {
 			path := strings.TrimPrefix(r.URL.Path, "/api/theory/")
 			if strings.HasSuffix(path, "/with-tests") {
 				GetTheoryWithTests(w, r)
+			} else if strings.HasSuffix(path, "/heartbeat") || strings.HasSuffix(path, "/complete") {
+				// POST /api/theory/{id}/heartbeat, POST|DELETE /api/theory/{id}/complete
+				TheoryProgressHandler(w, r)
 			} else {
 				GetTheoryItem(w, r)
 			}
@@ -299,6 +322,11 @@ func main() {
 						GetLatestAttempt(w, r)
 						return
 
+					// GET /api/tests/{testId}/grade — итоговая оценка по политике пересдач
+					case len(parts) == 2 && parts[1] == "grade" && r.Method == http.MethodGet:
+						GetEffectiveGrade(w, r)
+						return
+
 					default:
 						http.NotFound(w, r)
 						return
@@ -309,6 +337,8 @@ func main() {
 	)
 
 	// PATCH /api/attempts/{attemptId}/finish
+	// GET   /api/attempts/{attemptId} — разбор попытки по вопросам
+	//       /api/attempts/{attemptId}/comments[/{commentId}] — комментарии преподавателя
 	apiMux.Handle(
 		"/api/attempts/",
 		JWTAuthMiddleware(
@@ -320,6 +350,14 @@ func main() {
 						FinishTestAttempt(w, r)
 						return
 					}
+					if len(parts) == 1 && parts[0] != "" && r.Method == http.MethodGet {
+						GetAttemptReview(w, r)
+						return
+					}
+					if (len(parts) == 2 || len(parts) == 3) && parts[1] == "comments" {
+						AttemptCommentsHandler(w, r)
+						return
+					}
 					http.NotFound(w, r)
 				}),
 			),
@@ -332,24 +370,36 @@ func main() {
 	// === ПЛАНИРОВЩИК автоматического пересчёта сложности ===
 	c := cron.New()
 
-	// Запускаем пересчёт каждый день в 3:00 ночи
-	_, err = c.AddFunc("0 3 * * *", func() {
-		log.Println("Автоматический пересчёт сложности вопросов...")
-		if err := RecalcDifficulty(db); err != nil {
-			log.Println("Ошибка при автоматическом пересчёте:", err)
-		} else {
-			log.Println("Пересчёт сложности завершён успешно.")
+	// Ночной пересчёт — по расписанию из политики (см. difficulty.go);
+	// администратор может поменять его без перезапуска
+	recalcCron = c
+	policy, err := loadRecalcPolicy(db)
+	if err != nil {
+		log.Fatal("Не удалось загрузить политику пересчёта сложности:", err)
+	}
+	if err := scheduleRecalc(policy.Schedule); err != nil {
+		log.Fatal("Не удалось запланировать задачу пересчёта:", err)
+	}
+
+	// Раз в минуту закрываем попытки, у которых истекло время
+	_, err = c.AddFunc("@every 1m", func() {
+		if err := FinishExpiredAttempts(db); err != nil {
+			log.Println("Ошибка при завершении просроченных попыток:", err)
 		}
 	})
 	if err != nil {
-		log.Fatal("Не удалось запланировать задачу пересчёта:", err)
+		log.Fatal("Не удалось запланировать завершение просроченных попыток:", err)
 	}
 
 	// Запускаем cron-планировщик
 	c.Start()
 	defer c.Stop()
 
-	// запуск этой функции производит мгновенный пересчет сложности всех вопросов из БД
+	// Воркеры очереди предсказания сложности (см. difficultyjobs.go)
+	startDifficultyWorkers(db, difficultyWorkers)
+
+	// массовый ML-пересчёт сложности всех вопросов ставится в ту же очередь;
+	// обычно его запускают через POST /api/admin/difficulty/ml-batches
 	// if err := RecalcDifficultyML(db); err != nil {
 	// 	log.Println("Ошибка начального пересчёта сложности:", err)
 	// }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Статусы проверки ответа (user_question_answers.review_status)
+const (
+	reviewStatusAuto     = "auto"     // оценка выставлена автоматически
+	reviewStatusPending  = "pending"  // открытый ответ не совпал с эталоном — ждёт преподавателя
+	reviewStatusReviewed = "reviewed" // оценку выставил преподаватель
+)
+
+// isOpenQuestion — вопрос со свободным текстовым ответом, который
+// проверяется по похожести на correct_answer_text
+func isOpenQuestion(qType string) bool {
+	return qType != "closed" && qType != questionTypeSet && qType != questionTypeIdentity
+}
+
+// gradingQueueItem — ответ в очереди ручной проверки
+type gradingQueueItem struct {
+	AnswerID          int        `json:"answer_id"`
+	AttemptID         int        `json:"attempt_id"`
+	StudentID         int        `json:"student_id"`
+	StudentName       string     `json:"student_name"`
+	StudentEmail      string     `json:"student_email"`
+	TestID            int        `json:"test_id"`
+	TestTitle         string     `json:"test_title"`
+	QuestionID        int        `json:"question_id"`
+	QuestionText      string     `json:"question_text"`
+	CorrectAnswerText string     `json:"correct_answer_text"`
+	AnswerText        string     `json:"answer_text"`
+	IsCorrect         bool       `json:"is_correct"`
+	Points            float64    `json:"points"`
+	MaxPoints         float64    `json:"max_points"`
+	ReviewStatus      string     `json:"review_status"`
+	ReviewedAt        *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// teacherGradingHandler — очередь ручной проверки открытых ответов
+//
+//	GET   /api/teacher/grading?test_id=…&status=pending|reviewed|all — ответы на проверку
+//	PATCH /api/teacher/grading/{answerId} — выставить оценку и комментарий
+func teacherGradingHandler(w http.ResponseWriter, r *http.Request) {
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	teacherID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusInternalServerError)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/teacher/grading"), "/")
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		listGradingQueue(w, r, teacherID, claims.Role == "admin")
+	case rest != "" && r.Method == http.MethodPatch:
+		answerID, err := strconv.Atoi(rest)
+		if err != nil {
+			http.Error(w, "Invalid answer ID", http.StatusBadRequest)
+			return
+		}
+		gradeAnswerManually(w, r, teacherID, claims.Role == "admin", answerID)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listGradingQueue(w http.ResponseWriter, r *http.Request, teacherID int, isAdmin bool) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = reviewStatusPending
+	}
+	if status != reviewStatusPending && status != reviewStatusReviewed && status != "all" {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	testID, _ := strconv.Atoi(r.URL.Query().Get("test_id"))
+
+	rows, err := db.Query(`
+        SELECT a.id, a.attempt_id, u.id, u.full_name, u.email,
+               t.id, t.title, q.id, q.question_text, COALESCE(q.correct_answer_text, ''),
+               COALESCE(a.answer_text, ''), a.is_correct, a.points, q.points,
+               a.review_status, a.reviewed_at
+          FROM user_question_answers a
+          JOIN questions q ON q.id = a.question_id
+          JOIN tests t     ON t.id = q.test_id
+          JOIN courses c   ON c.id = t.course_id
+          JOIN users u     ON u.id = a.user_id
+         WHERE q.question_type NOT IN ('closed', $1, $2)
+           AND ($3 = 'all' AND a.review_status <> $4 OR a.review_status = $3)
+           AND ($5 OR c.teacher_id = $6)
+           AND ($7 = 0 OR t.id = $7)
+         ORDER BY a.id
+    `, questionTypeSet, questionTypeIdentity, status, reviewStatusAuto, isAdmin, teacherID, testID)
+	if err != nil {
+		log.Println("listGradingQueue error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	items := []gradingQueueItem{}
+	for rows.Next() {
+		var it gradingQueueItem
+		var reviewedAt sql.NullTime
+		if err := rows.Scan(
+			&it.AnswerID, &it.AttemptID, &it.StudentID, &it.StudentName, &it.StudentEmail,
+			&it.TestID, &it.TestTitle, &it.QuestionID, &it.QuestionText, &it.CorrectAnswerText,
+			&it.AnswerText, &it.IsCorrect, &it.Points, &it.MaxPoints,
+			&it.ReviewStatus, &reviewedAt,
+		); err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		if reviewedAt.Valid {
+			it.ReviewedAt = &reviewedAt.Time
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, items)
+}
+
+func gradeAnswerManually(w http.ResponseWriter, r *http.Request, teacherID int, isAdmin bool, answerID int) {
+	var req struct {
+		IsCorrect bool     `json:"is_correct"`
+		Points    *float64 `json:"points"` // nil — полный балл за верный ответ, ноль за неверный
+		Comment   string   `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if req.Comment != "" && !validCommentBody(req.Comment) {
+		http.Error(w, "Комментарий пуст или слишком длинный", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		attemptID    int
+		questionID   int
+		owner        sql.NullInt64
+		maxPoints    float64
+		qType        string
+		reviewStatus string
+	)
+	err = tx.QueryRow(`
+        SELECT a.attempt_id, a.question_id, c.teacher_id, q.points, q.question_type, a.review_status
+          FROM user_question_answers a
+          JOIN questions q ON q.id = a.question_id
+          JOIN tests t     ON t.id = q.test_id
+          JOIN courses c   ON c.id = t.course_id
+         WHERE a.id = $1
+           FOR UPDATE OF a
+    `, answerID).Scan(&attemptID, &questionID, &owner, &maxPoints, &qType, &reviewStatus)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Answer not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if !isAdmin && (!owner.Valid || int(owner.Int64) != teacherID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	// Вручную оцениваются только открытые ответы из очереди проверки;
+	// автоматическую оценку закрытых вопросов и совпавших ответов не переписываем
+	if !isOpenQuestion(qType) || reviewStatus == reviewStatusAuto {
+		http.Error(w, "Answer is not subject to manual review", http.StatusConflict)
+		return
+	}
+
+	points := 0.0
+	if req.IsCorrect {
+		points = maxPoints
+	}
+	if req.Points != nil {
+		points = *req.Points
+	}
+	if points < 0 || points > maxPoints {
+		http.Error(w, "points must be between 0 and the question weight", http.StatusBadRequest)
+		return
+	}
+	// Неверный ответ без баллов, верный — с баллами (частичный зачёт допустим)
+	if req.IsCorrect != (points > 0) {
+		http.Error(w, "is_correct=true requires points > 0, is_correct=false requires points = 0", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := tx.Exec(`
+        UPDATE user_question_answers
+           SET is_correct    = $1,
+               points        = $2,
+               review_status = $3,
+               reviewed_by   = $4,
+               reviewed_at   = NOW()
+         WHERE id = $5
+    `, req.IsCorrect, points, reviewStatusReviewed, teacherID, answerID); err != nil {
+		log.Println("gradeAnswerManually update error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	// Комментарий к оценке — обычный комментарий к ответу: студент увидит его
+	// в /api/me/feedback как непрочитанный
+	if req.Comment != "" {
+		if _, err := tx.Exec(`
+            INSERT INTO attempt_comments (attempt_id, answer_id, question_id, author_id, body)
+            VALUES ($1, $2, $3, $4, $5)
+        `, attemptID, answerID, questionID, teacherID, strings.TrimSpace(req.Comment)); err != nil {
+			log.Println("gradeAnswerManually comment error:", err)
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Итог попытки пересчитывается с учётом новой оценки
+	score, correct, wrong, err := recalcAttemptTotals(tx, attemptID)
+	if err != nil {
+		log.Println("gradeAnswerManually recalc error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":              true,
+		"attempt_id":      attemptID,
+		"score":           score,
+		"correct_answers": correct,
+		"wrong_answers":   wrong,
+	})
+}
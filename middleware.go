@@ -22,6 +22,17 @@ func getClaims(ctx context.Context) *Claims {
 	return nil
 }
 
+// currentUserID возвращает ID пользователя из claims, а если его там нет —
+// достаёт по email (токены, выданные loginHandler, содержат только email и роль)
+func currentUserID(claims *Claims) (int, error) {
+	if claims.UserID != 0 {
+		return claims.UserID, nil
+	}
+	var id int
+	err := db.QueryRow(`SELECT id FROM users WHERE email = $1`, claims.Email).Scan(&id)
+	return id, err
+}
+
 // JWTAuthMiddleware проверяет JWT и кладёт Claims в контекст
 func JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
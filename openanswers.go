@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"registration_form/setexpr"
+)
+
+// Виды допустимых ответов на открытый вопрос (questions.accepted_answers)
+const (
+	acceptText   = "text"   // совпадение строки после нормализации
+	acceptRegex  = "regex"  // ответ целиком подходит под регулярное выражение
+	acceptNumber = "number" // число с допуском tolerance
+	acceptSet    = "set"    // перечисление {…}: порядок и повторы не важны
+)
+
+// AcceptedAnswer — один допустимый ответ на открытый вопрос.
+// Флаги Ignore* задают нормализацию для text и regex.
+type AcceptedAnswer struct {
+	Kind              string  `json:"kind"`
+	Value             string  `json:"value"`
+	Tolerance         float64 `json:"tolerance,omitempty"`
+	IgnoreCase        bool    `json:"ignore_case,omitempty"`
+	IgnoreWhitespace  bool    `json:"ignore_whitespace,omitempty"`
+	IgnorePunctuation bool    `json:"ignore_punctuation,omitempty"`
+}
+
+// AcceptedAnswers хранится в questions.accepted_answers (JSONB).
+// Пустой список — ответ сравнивается с correct_answer_text по похожести, как раньше.
+type AcceptedAnswers []AcceptedAnswer
+
+func (a AcceptedAnswers) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(a)
+	// строкой, а не []byte — иначе pq передаст значение как bytea
+	return string(b), err
+}
+
+func (a *AcceptedAnswers) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	}
+	return fmt.Errorf("AcceptedAnswers: unsupported type %T", src)
+}
+
+// validate проверяет, что каждый ответ списка можно применить при проверке
+func (a AcceptedAnswers) validate() error {
+	for i, acc := range a {
+		if strings.TrimSpace(acc.Value) == "" {
+			return fmt.Errorf("ответ %d: пустое значение", i+1)
+		}
+		switch acc.Kind {
+		case acceptText:
+		case acceptRegex:
+			if _, err := acc.regexp(); err != nil {
+				return fmt.Errorf("ответ %d: %w", i+1, err)
+			}
+		case acceptNumber:
+			if _, err := parseNumber(acc.Value); err != nil {
+				return fmt.Errorf("ответ %d: %q не число", i+1, acc.Value)
+			}
+			if acc.Tolerance < 0 {
+				return fmt.Errorf("ответ %d: отрицательный допуск", i+1)
+			}
+		case acceptSet:
+			if _, err := setexpr.ParseSet(acc.Value); err != nil {
+				return fmt.Errorf("ответ %d: %w", i+1, err)
+			}
+		default:
+			return fmt.Errorf("ответ %d: неизвестный вид %q", i+1, acc.Kind)
+		}
+	}
+	return nil
+}
+
+// validateAcceptedAnswers — список допустим только у открытых вопросов
+func validateAcceptedAnswers(qType string, a AcceptedAnswers) error {
+	if len(a) == 0 {
+		return nil
+	}
+	if !isOpenQuestion(qType) {
+		return fmt.Errorf("список допустимых ответов задаётся только для открытых вопросов")
+	}
+	return a.validate()
+}
+
+// match — подходит ли ответ студента хотя бы под один допустимый
+func (a AcceptedAnswers) match(answer string) bool {
+	for _, acc := range a {
+		if acc.match(answer) {
+			return true
+		}
+	}
+	return false
+}
+
+func (acc AcceptedAnswer) match(answer string) bool {
+	switch acc.Kind {
+	case acceptText:
+		return acc.normalize(answer) == acc.normalize(acc.Value)
+	case acceptRegex:
+		re, err := acc.regexp()
+		return err == nil && re.MatchString(acc.normalize(answer))
+	case acceptNumber:
+		want, err1 := parseNumber(acc.Value)
+		got, err2 := parseNumber(answer)
+		return err1 == nil && err2 == nil && math.Abs(got-want) <= acc.Tolerance
+	case acceptSet:
+		want, err1 := setexpr.ParseSet(acc.Value)
+		got, err2 := setexpr.ParseSet(answer)
+		return err1 == nil && err2 == nil && got.Equal(want)
+	}
+	return false
+}
+
+// regexp компилирует шаблон так, чтобы он покрывал ответ целиком
+func (acc AcceptedAnswer) regexp() (*regexp.Regexp, error) {
+	pattern := "^(?:" + acc.Value + ")$"
+	if acc.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// normalize приводит строку к виду, в котором её сравнивают:
+// пробелы по краям отбрасываются всегда, остальное — по флагам
+func (acc AcceptedAnswer) normalize(s string) string {
+	s = strings.TrimSpace(s)
+	if acc.IgnorePunctuation {
+		s = strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	if acc.IgnoreWhitespace {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+	// для regex регистр учитывает сам шаблон через (?i)
+	if acc.IgnoreCase && acc.Kind == acceptText {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// parseNumber принимает и десятичную точку, и запятую: 3.14 и 3,14
+func parseNumber(s string) (float64, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", ".")
+	return strconv.ParseFloat(s, 64)
+}
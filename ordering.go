@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// attemptOrder — порядок вопросов и вариантов ответа, выданный попытке.
+// Хранится в user_test_attempts.question_order (JSONB), поэтому при
+// перезагрузке страницы посреди попытки порядок не меняется.
+// Пустые списки — порядок по id.
+type attemptOrder struct {
+	Questions []int         `json:"questions,omitempty"`
+	Options   map[int][]int `json:"options,omitempty"` // question_id → id вариантов
+}
+
+func (o *attemptOrder) Value() (driver.Value, error) {
+	if o == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(o)
+	return string(b), err
+}
+
+func (o *attemptOrder) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*o = attemptOrder{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, o)
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	}
+	return fmt.Errorf("attemptOrder: unsupported type %T", src)
+}
+
+// errBadOptionPosition — студент прислал номер варианта, которого нет
+var errBadOptionPosition = errors.New("некорректный номер варианта ответа")
+
+// buildAttemptOrder перемешивает вопросы и/или варианты теста по его
+// настройкам. nil — тест не перемешивается.
+func buildAttemptOrder(q queryer, testID int, seed int64) (*attemptOrder, error) {
+	var shuffleQuestions, shuffleOptions bool
+	if err := q.QueryRow(
+		`SELECT shuffle_questions, shuffle_options FROM tests WHERE id = $1`, testID,
+	).Scan(&shuffleQuestions, &shuffleOptions); err != nil {
+		return nil, err
+	}
+	if !shuffleQuestions && !shuffleOptions {
+		return nil, nil
+	}
+
+	rows, err := q.Query(`
+        SELECT q.id, o.id
+          FROM questions q
+          LEFT JOIN options o ON o.question_id = q.id
+         WHERE q.test_id = $1
+         ORDER BY q.id, o.id
+    `, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	order := &attemptOrder{}
+	options := map[int][]int{}
+	for rows.Next() {
+		var qid int
+		var oid sql.NullInt64
+		if err := rows.Scan(&qid, &oid); err != nil {
+			return nil, err
+		}
+		if n := len(order.Questions); n == 0 || order.Questions[n-1] != qid {
+			order.Questions = append(order.Questions, qid)
+		}
+		if oid.Valid {
+			options[qid] = append(options[qid], int(oid.Int64))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	if shuffleQuestions {
+		rng.Shuffle(len(order.Questions), func(i, j int) {
+			order.Questions[i], order.Questions[j] = order.Questions[j], order.Questions[i]
+		})
+	} else {
+		order.Questions = nil
+	}
+	if shuffleOptions {
+		order.Options = options
+		for _, qid := range sortedKeys(options) {
+			ids := options[qid]
+			rng.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+		}
+	}
+	return order, nil
+}
+
+// sortedKeys — ключи в фиксированном порядке, чтобы перемешивание
+// зависело только от seed
+func sortedKeys(m map[int][]int) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// loadAttemptOrder читает порядок, сохранённый для попытки
+func loadAttemptOrder(q queryer, attemptID int) (attemptOrder, error) {
+	var order attemptOrder
+	err := q.QueryRow(
+		`SELECT question_order FROM user_test_attempts WHERE id = $1`, attemptID,
+	).Scan(&order)
+	return order, err
+}
+
+// arrange упорядочивает ids (в порядке по id) согласно order.
+// Элементы, которых нет в order (например, вопрос добавили во время
+// попытки), идут в конце; исчезнувшие из ids пропускаются.
+func arrange(ids, order []int) []int {
+	if len(order) == 0 {
+		return ids
+	}
+	present := map[int]bool{}
+	for _, id := range ids {
+		present[id] = true
+	}
+	out := make([]int, 0, len(ids))
+	for _, id := range order {
+		if present[id] {
+			out = append(out, id)
+			delete(present, id)
+		}
+	}
+	for _, id := range ids {
+		if present[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// applyAttemptOrder расставляет вопросы (и их варианты) в порядке попытки
+func applyAttemptOrder(questions []QuestionInfo, order attemptOrder) []QuestionInfo {
+	byID := make(map[int]QuestionInfo, len(questions))
+	ids := make([]int, len(questions))
+	for i, q := range questions {
+		byID[q.ID] = q
+		ids[i] = q.ID
+	}
+
+	out := make([]QuestionInfo, 0, len(questions))
+	for _, id := range arrange(ids, order.Questions) {
+		q := byID[id]
+		if optOrder := order.Options[id]; len(optOrder) > 0 {
+			optByID := make(map[int]OptionInfo, len(q.Options))
+			optIDs := make([]int, len(q.Options))
+			for i, o := range q.Options {
+				optByID[o.ID] = o
+				optIDs[i] = o.ID
+			}
+			opts := make([]OptionInfo, 0, len(q.Options))
+			for _, oid := range arrange(optIDs, optOrder) {
+				opts = append(opts, optByID[oid])
+			}
+			q.Options = opts
+		}
+		out = append(out, q)
+	}
+	return out
+}
+
+// optionIDsAtPositions переводит номера вариантов в том порядке, в котором
+// их видел студент (с нуля), в канонические id вариантов
+func optionIDsAtPositions(q queryer, attemptID, questionID int, positions []int) ([]int, error) {
+	rows, err := q.Query(`SELECT id FROM options WHERE question_id = $1 ORDER BY id`, questionID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	order, err := loadAttemptOrder(q, attemptID)
+	if err != nil {
+		return nil, err
+	}
+	shown := arrange(ids, order.Options[questionID])
+
+	out := make([]int, 0, len(positions))
+	for _, p := range positions {
+		if p < 0 || p >= len(shown) {
+			return nil, errBadOptionPosition
+		}
+		out = append(out, shown[p])
+	}
+	return out, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DifficultyInput — то, по чему предсказывается сложность вопроса
+type DifficultyInput struct {
+	Text string
+	Type string
+	Sets SetDefinitions
+}
+
+// DifficultyPredictor оценивает сложность нового вопроса: easy, medium или hard
+type DifficultyPredictor interface {
+	Predict(ctx context.Context, in DifficultyInput) (string, error)
+}
+
+// difficultyPredictor — предсказатель, которым пользуются обработчики и
+// RecalcDifficultyML: ML-сервис, а если он недоступен — эвристика
+var difficultyPredictor DifficultyPredictor = newMLPredictor(mlPredictURL, heuristicPredictor{})
+
+// Настройки клиента ML-сервиса
+const (
+	mlPredictURL = "http://localhost:5000/predict"
+	mlTimeout    = 2 * time.Second
+	mlRetries    = 2 // повторов после первой неудачной попытки
+	mlBackoff    = 200 * time.Millisecond
+	// после стольких неудач подряд запросы к сервису не шлются mlCooldown
+	mlFailureThreshold = 3
+	mlCooldown         = 30 * time.Second
+)
+
+var errCircuitOpen = errors.New("ML-сервис временно отключён после серии ошибок")
+
+func validDifficulty(d string) bool {
+	return d == "easy" || d == "medium" || d == "hard"
+}
+
+// circuitBreaker размыкается после threshold неудач подряд; по истечении
+// cooldown пропускает один пробный запрос и по его итогу замыкается или
+// снова размыкается
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	// пробный запрос; остальные ждут следующего cooldown
+	b.openedAt = time.Now()
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	b.failures = 0
+	b.mu.Unlock()
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+	b.mu.Unlock()
+}
+
+// mlPredictor — клиент Flask-сервиса сложности с таймаутом, повторами,
+// предохранителем и запасным предсказателем
+type mlPredictor struct {
+	url      string
+	client   *http.Client
+	retries  int
+	backoff  time.Duration
+	breaker  *circuitBreaker
+	fallback DifficultyPredictor // nil — ошибка возвращается вызывающему
+}
+
+func newMLPredictor(url string, fallback DifficultyPredictor) *mlPredictor {
+	return &mlPredictor{
+		url:      url,
+		client:   &http.Client{Timeout: mlTimeout},
+		retries:  mlRetries,
+		backoff:  mlBackoff,
+		breaker:  &circuitBreaker{threshold: mlFailureThreshold, cooldown: mlCooldown},
+		fallback: fallback,
+	}
+}
+
+// withoutFallback — тот же клиент (и тот же предохранитель), но без запасной оценки
+func (m *mlPredictor) withoutFallback() *mlPredictor {
+	c := *m
+	c.fallback = nil
+	return &c
+}
+
+func (m *mlPredictor) Predict(ctx context.Context, in DifficultyInput) (string, error) {
+	if !m.breaker.allow() {
+		return m.fallbackPredict(ctx, in, errCircuitOpen)
+	}
+	var lastErr error
+	for attempt := 0; attempt <= m.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(m.backoff * time.Duration(attempt)):
+			case <-ctx.Done():
+				return m.fallbackPredict(ctx, in, ctx.Err())
+			}
+		}
+		diff, retryable, err := m.call(ctx, in.Text)
+		if err == nil {
+			m.breaker.success()
+			return diff, nil
+		}
+		lastErr = err
+		if !retryable {
+			// сервис ответил, но ответ не годится — он жив, предохранитель не трогаем
+			return m.fallbackPredict(ctx, in, err)
+		}
+	}
+	m.breaker.failure()
+	return m.fallbackPredict(ctx, in, lastErr)
+}
+
+func (m *mlPredictor) fallbackPredict(ctx context.Context, in DifficultyInput, cause error) (string, error) {
+	if m.fallback == nil {
+		return "", cause
+	}
+	log.Println("ML predict error, используем запасную оценку:", cause)
+	return m.fallback.Predict(ctx, in)
+}
+
+// call — один запрос к сервису; retryable — сетевая ошибка, таймаут или 5xx
+func (m *mlPredictor) call(ctx context.Context, text string) (diff string, retryable bool, err error) {
+	payload, _ := json.Marshal(map[string]string{"question_text": text})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, bytes.NewReader(payload))
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", true, err
+	}
+	if resp.StatusCode >= 500 {
+		return "", true, fmt.Errorf("ml status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Difficulty string `json:"difficulty"`
+		Error      string `json:"error,omitempty"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", false, err
+	}
+	if out.Error != "" {
+		return "", false, fmt.Errorf("ml error: %s", out.Error)
+	}
+	if !validDifficulty(out.Difficulty) {
+		return "", false, fmt.Errorf("ml: неизвестная сложность %q", out.Difficulty)
+	}
+	return out.Difficulty, false, nil
+}
+
+// Символы операций над множествами, которые учитывает эвристика
+// (ASCII-замены + - * не считаем: они часто встречаются в обычном тексте)
+const setOperatorRunes = `∪∩\∖−Δ∆△⊕¬~'ᶜ|&^`
+
+// heuristicPredictor — оценка без ML: длина формулировки, число операций
+// над множествами и число множеств. Каждый признак приводится к [0, 1].
+type heuristicPredictor struct{}
+
+func (heuristicPredictor) Predict(_ context.Context, in DifficultyInput) (string, error) {
+	length := float64(utf8.RuneCountInString(in.Text))
+
+	ops := 0
+	for _, r := range in.Text {
+		if strings.ContainsRune(setOperatorRunes, r) {
+			ops++
+		}
+	}
+
+	// множества берём из определений вопроса, иначе — отдельные заглавные латинские буквы в тексте
+	sets := len(in.Sets)
+	if sets == 0 {
+		seen := map[rune]bool{}
+		runes := []rune(in.Text)
+		for i, r := range runes {
+			if r < 'A' || r > 'Z' {
+				continue
+			}
+			if (i > 0 && unicode.IsLetter(runes[i-1])) || (i+1 < len(runes) && unicode.IsLetter(runes[i+1])) {
+				continue
+			}
+			seen[r] = true
+		}
+		sets = len(seen)
+	}
+
+	score := 0.3*math.Min(length/300, 1) +
+		0.4*math.Min(float64(ops)/6, 1) +
+		0.3*math.Min(float64(max(sets-1, 0))/3, 1)
+	switch {
+	case score < 0.25:
+		return "easy", nil
+	case score < 0.55:
+		return "medium", nil
+	}
+	return "hard", nil
+}
+
+// stubPredictor всегда возвращает заданный ответ — для тестов и локальной
+// разработки без ML-сервиса
+type stubPredictor struct {
+	Difficulty string
+	Err        error
+}
+
+func (s stubPredictor) Predict(context.Context, DifficultyInput) (string, error) {
+	return s.Difficulty, s.Err
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	// шаги: f — неудача, s — успех, w — ждать дольше cooldown;
+	// allow — что вернёт allow() после шага
+	tests := []struct {
+		name  string
+		steps string
+		allow []bool
+	}{
+		{"замкнут без ошибок", "s", []bool{true}},
+		{"неудачи до порога", "ff", []bool{true, true}},
+		{"размыкается на пороге", "fff", []bool{true, true, false}},
+		{"успех сбрасывает счётчик", "ffsff", []bool{true, true, true, true, true}},
+		{"после cooldown пробный запрос", "fffw", []bool{true, true, false, true}},
+		{"неудачный пробный запрос снова размыкает", "fffwf", []bool{true, true, false, true, false}},
+		{"удачный пробный запрос замыкает", "fffws", []bool{true, true, false, true, true}},
+	}
+	for _, tt := range tests {
+		b := &circuitBreaker{threshold: 3, cooldown: time.Hour}
+		for i, step := range tt.steps {
+			switch step {
+			case 'f':
+				b.failure()
+			case 's':
+				b.success()
+			case 'w':
+				b.openedAt = b.openedAt.Add(-2 * b.cooldown)
+			}
+			if got := b.allow(); got != tt.allow[i] {
+				t.Errorf("%s: шаг %d (%c): allow() = %v, want %v", tt.name, i, step, got, tt.allow[i])
+			}
+		}
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	b := &circuitBreaker{threshold: 1, cooldown: time.Hour}
+	b.failure()
+	b.openedAt = b.openedAt.Add(-2 * b.cooldown)
+	if !b.allow() {
+		t.Fatal("после cooldown пробный запрос должен пройти")
+	}
+	if b.allow() {
+		t.Fatal("второй запрос до итога пробного должен ждать следующего cooldown")
+	}
+}
+
+func TestHeuristicPredictor(t *testing.T) {
+	long := ""
+	for len([]rune(long)) < 300 {
+		long += "Дано универсальное множество и несколько его подмножеств. "
+	}
+	tests := []struct {
+		name string
+		in   DifficultyInput
+		want string
+	}{
+		{"короткий с одной операцией", DifficultyInput{Text: "Найдите A ∪ B"}, "easy"},
+		{"без множеств", DifficultyInput{Text: "Что такое пустое множество?"}, "easy"},
+		{"несколько операций и множеств", DifficultyInput{Text: "Найдите (A ∪ B) ∩ C \\ D"}, "medium"},
+		{"много операций и множеств", DifficultyInput{Text: "Найдите ((A ∪ B) ∩ (C Δ D)) \\ (A ∩ C)'"}, "hard"},
+		{"длинный текст без операций", DifficultyInput{Text: long}, "medium"},
+		// буквы внутри слов — не имена множеств
+		{"заглавные в словах", DifficultyInput{Text: "Big Data, Cloud, Edge"}, "easy"},
+		// множества берутся из определений вопроса, а не из текста
+		{"множества из определений", DifficultyInput{
+			Text: "Вычислите выражение",
+			Sets: SetDefinitions{"A": "{1}", "B": "{2}", "C": "{3}", "D": "{4}"},
+		}, "medium"},
+	}
+	for _, tt := range tests {
+		got, err := heuristicPredictor{}.Predict(context.Background(), tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Predict(%q) = %s, want %s", tt.name, tt.in.Text, got, tt.want)
+		}
+	}
+}
+
+func TestMLPredictor(t *testing.T) {
+	errStub := errors.New("stub")
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		fallback DifficultyPredictor
+		want     string
+		wantErr  bool
+		calls    int32 // сколько запросов дойдёт до сервиса (retries = 1)
+	}{
+		{"ответ сервиса", http.StatusOK, `{"difficulty":"hard"}`, stubPredictor{Difficulty: "easy"}, "hard", false, 1},
+		{"5xx — повтор, затем запасная оценка", http.StatusInternalServerError, `{}`, stubPredictor{Difficulty: "medium"}, "medium", false, 2},
+		// лишние поля ответа не влияют на метку
+		{"лишние поля", http.StatusOK, `{"difficulty":"easy","difficulty_logit":3.5}`, stubPredictor{Difficulty: "hard"}, "easy", false, 1},
+		{"неизвестная метка — без повтора", http.StatusOK, `{"difficulty":"extreme"}`, stubPredictor{Difficulty: "easy"}, "easy", false, 1},
+		{"ошибка сервиса", http.StatusOK, `{"error":"model not loaded"}`, stubPredictor{Difficulty: "medium"}, "medium", false, 1},
+		{"без запасной оценки", http.StatusInternalServerError, `{}`, nil, "", true, 2},
+		{"ошибка запасной оценки", http.StatusBadGateway, `{}`, stubPredictor{Err: errStub}, "", true, 2},
+	}
+	for _, tt := range tests {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}))
+		m := newMLPredictor(srv.URL, tt.fallback)
+		m.retries, m.backoff = 1, 0
+
+		got, err := m.Predict(context.Background(), DifficultyInput{Text: "A ∪ B"})
+		srv.Close()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Predict = %q, want %q", tt.name, got, tt.want)
+		}
+		if calls := atomic.LoadInt32(&calls); calls != tt.calls {
+			t.Errorf("%s: запросов к сервису %d, want %d", tt.name, calls, tt.calls)
+		}
+	}
+}
+
+func TestMLPredictorCircuitOpen(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	m := newMLPredictor(srv.URL, stubPredictor{Difficulty: "medium"})
+	m.retries, m.backoff = 0, 0
+	for i := 0; i < mlFailureThreshold+2; i++ {
+		if got, err := m.Predict(context.Background(), DifficultyInput{}); err != nil || got != "medium" {
+			t.Fatalf("запрос %d: Predict = %q, %v", i, got, err)
+		}
+	}
+	// после порога сервис не вызывается, ответ даёт запасной предсказатель
+	if calls := atomic.LoadInt32(&calls); calls != mlFailureThreshold {
+		t.Errorf("запросов к сервису %d, want %d", calls, mlFailureThreshold)
+	}
+
+	// без запасной оценки разомкнутый предохранитель возвращает ошибку
+	if _, err := m.withoutFallback().Predict(context.Background(), DifficultyInput{}); err != errCircuitOpen {
+		t.Errorf("withoutFallback: err = %v, want errCircuitOpen", err)
+	}
+}
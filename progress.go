@@ -0,0 +1,265 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+// passShare — доля от максимального балла, начиная с которой тест считается сданным
+const passShare = 0.6
+
+// courseProgress — прогресс студента по одному курсу
+type courseProgress struct {
+	CourseID        int                           `json:"course_id"`
+	Title           string                        `json:"title"`
+	TheoryTotal     int                           `json:"theory_total"`
+	TheoryViewed    int                           `json:"theory_viewed"`
+	TheoryCompleted int                           `json:"theory_completed"`
+	TimeSpent       int                           `json:"theory_time_spent"` // секунды на страницах теории
+	TestsTotal      int                           `json:"tests_total"`
+	TestsAttempted  int                           `json:"tests_attempted"`
+	TestsPassed     int                           `json:"tests_passed"`
+	Tests           []testProgress                `json:"tests"`
+	Accuracy        map[string]difficultyAccuracy `json:"accuracy_by_difficulty"`
+}
+
+// testProgress — результаты по тесту; Trend — баллы завершённых попыток по порядку
+type testProgress struct {
+	TestID    int       `json:"test_id"`
+	Title     string    `json:"title"`
+	MaxScore  float64   `json:"max_score"`
+	Attempts  int       `json:"attempts"`
+	BestScore *float64  `json:"best_score"`
+	LastScore *float64  `json:"last_score"`
+	Passed    bool      `json:"passed"`
+	Trend     []float64 `json:"trend"`
+	Direction string    `json:"trend_direction,omitempty"` // up, down или flat; пусто, пока попыток меньше двух
+}
+
+type difficultyAccuracy struct {
+	Answered int     `json:"answered"`
+	Correct  int     `json:"correct"`
+	Accuracy float64 `json:"accuracy"` // доля верных ответов, от 0 до 1
+}
+
+// trendDirection — знак наклона прямой, проведённой по баллам методом наименьших квадратов
+func trendDirection(scores []float64) string {
+	n := float64(len(scores))
+	if n < 2 {
+		return ""
+	}
+	var sx, sy, sxx, sxy float64
+	for i, y := range scores {
+		x := float64(i)
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	slope := (n*sxy - sx*sy) / (n*sxx - sx*sx)
+	switch {
+	case slope > 1e-9:
+		return "up"
+	case slope < -1e-9:
+		return "down"
+	}
+	return "flat"
+}
+
+// loadProgress собирает прогресс пользователя по его курсам: тем, где у него
+// есть попытки или просмотры теории, и курсам преподавателя его группы
+func loadProgress(q queryer, userID int) ([]courseProgress, error) {
+	out := []courseProgress{}
+	byCourse := map[int]*courseProgress{}
+
+	rows, err := q.Query(`
+        SELECT c.id, c.title,
+               COUNT(th.id), COUNT(v.theory_id), COUNT(v.completed_at), COALESCE(SUM(v.time_spent), 0)
+          FROM courses c
+          LEFT JOIN theory th      ON th.course_id = c.id
+          LEFT JOIN theory_views v ON v.theory_id = th.id AND v.user_id = $1
+         WHERE EXISTS (SELECT 1 FROM user_test_attempts a
+                         JOIN tests t ON t.id = a.test_id
+                        WHERE t.course_id = c.id AND a.user_id = $1)
+            OR EXISTS (SELECT 1 FROM theory_views tv
+                         JOIN theory t ON t.id = tv.theory_id
+                        WHERE t.course_id = c.id AND tv.user_id = $1)
+            OR c.teacher_id IN (SELECT g.teacher_id FROM student_groups sg
+                                  JOIN groups g ON g.id = sg.group_id
+                                 WHERE sg.student_id = $1 AND sg.removed_at IS NULL)
+         GROUP BY c.id, c.title
+         ORDER BY c.id
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		cp := courseProgress{Tests: []testProgress{}, Accuracy: map[string]difficultyAccuracy{}}
+		if err := rows.Scan(&cp.CourseID, &cp.Title, &cp.TheoryTotal, &cp.TheoryViewed, &cp.TheoryCompleted, &cp.TimeSpent); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, cp)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	courseIDs := make([]int64, len(out))
+	for i := range out {
+		byCourse[out[i].CourseID] = &out[i]
+		courseIDs[i] = int64(out[i].CourseID)
+	}
+
+	// Тесты курсов и их максимальный балл
+	type testRef struct{ course, index int }
+	tests := map[int]testRef{}
+	rows, err = q.Query(`
+        SELECT t.id, t.course_id, t.title,
+               COALESCE((SELECT SUM(points) FROM questions WHERE test_id = t.id), 0)
+          FROM tests t
+         WHERE t.course_id = ANY($1)
+         ORDER BY t.id
+    `, pq.Array(courseIDs))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var (
+			tp       testProgress
+			courseID int
+		)
+		if err := rows.Scan(&tp.TestID, &courseID, &tp.Title, &tp.MaxScore); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		cp := byCourse[courseID]
+		if cp == nil {
+			continue
+		}
+		tp.Trend = []float64{}
+		cp.Tests = append(cp.Tests, tp)
+		cp.TestsTotal++
+		tests[tp.TestID] = testRef{courseID, len(cp.Tests) - 1}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Завершённые попытки — в хронологическом порядке
+	rows, err = q.Query(`
+        SELECT test_id, score
+          FROM user_test_attempts
+         WHERE user_id = $1 AND finished_at IS NOT NULL
+         ORDER BY finished_at, id
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var (
+			testID int
+			score  float64
+		)
+		if err := rows.Scan(&testID, &score); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ref, ok := tests[testID]
+		if !ok {
+			continue
+		}
+		tp := &byCourse[ref.course].Tests[ref.index]
+		tp.Attempts++
+		tp.Trend = append(tp.Trend, score)
+		last := score
+		tp.LastScore = &last
+		if tp.BestScore == nil || score > *tp.BestScore {
+			best := score
+			tp.BestScore = &best
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		cp := &out[i]
+		for j := range cp.Tests {
+			tp := &cp.Tests[j]
+			if tp.Attempts == 0 {
+				continue
+			}
+			cp.TestsAttempted++
+			tp.Passed = tp.MaxScore > 0 && *tp.BestScore >= passShare*tp.MaxScore
+			if tp.Passed {
+				cp.TestsPassed++
+			}
+			tp.Direction = trendDirection(tp.Trend)
+		}
+	}
+
+	// Точность ответов по уровням сложности; вопросы без метки и ещё ждущие
+	// предсказания (pending) попадают в unknown
+	rows, err = q.Query(`
+        SELECT t.course_id, COALESCE(NULLIF(NULLIF(q.difficulty, ''), 'pending'), 'unknown'),
+               COUNT(*), COUNT(*) FILTER (WHERE a.is_correct)
+          FROM user_question_answers a
+          JOIN questions q ON q.id = a.question_id
+          JOIN tests t     ON t.id = q.test_id
+         WHERE a.user_id = $1
+         GROUP BY 1, 2
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			courseID int
+			level    string
+			acc      difficultyAccuracy
+		)
+		if err := rows.Scan(&courseID, &level, &acc.Answered, &acc.Correct); err != nil {
+			return nil, err
+		}
+		cp := byCourse[courseID]
+		if cp == nil {
+			continue
+		}
+		if acc.Answered > 0 {
+			acc.Accuracy = float64(acc.Correct) / float64(acc.Answered)
+		}
+		cp.Accuracy[level] = acc
+	}
+	return out, rows.Err()
+}
+
+// GET /api/me/progress — прогресс текущего пользователя по курсам
+func MyProgressHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Не авторизован", http.StatusUnauthorized)
+		return
+	}
+	userID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
+	}
+
+	progress, err := loadProgress(db, userID)
+	if err != nil {
+		log.Println("loadProgress error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, progress)
+}
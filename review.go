@@ -0,0 +1,99 @@
+package main
+
+// Политики показа ключа ответов студентам (tests.review_policy)
+const (
+	// ключ никогда не показывается студентам
+	reviewNever = "never"
+	// ключ виден после завершённой попытки, если сейчас нет незавершённой;
+	// при нескольких попытках студент видит ключ до следующей
+	reviewAfterFinish = "after_finish"
+	// ключ виден, когда попытки исчерпаны и незавершённых нет (по умолчанию);
+	// у теста без лимита попыток ключ студентам не показывается
+	reviewAfterLastAttempt = "after_last_attempt"
+)
+
+func validReviewPolicy(p string) bool {
+	return p == reviewNever || p == reviewAfterFinish || p == reviewAfterLastAttempt
+}
+
+// canSeeAnswerKey решает, можно ли показать пользователю правильные ответы теста.
+// Преподаватели и администраторы видят ключ всегда.
+func canSeeAnswerKey(q queryer, role string, userID, testID int) (bool, error) {
+	if role == "teacher" || role == "admin" {
+		return true, nil
+	}
+
+	var policy string
+	if err := q.QueryRow(
+		`SELECT review_policy FROM tests WHERE id = $1`, testID,
+	).Scan(&policy); err != nil {
+		return false, err
+	}
+	if policy != reviewAfterFinish && policy != reviewAfterLastAttempt {
+		return false, nil
+	}
+
+	var visible bool
+	err := q.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM user_test_attempts
+                       WHERE user_id = $1 AND test_id = $2 AND finished_at IS NOT NULL)
+           AND NOT EXISTS(SELECT 1 FROM user_test_attempts
+                           WHERE user_id = $1 AND test_id = $2 AND finished_at IS NULL)
+    `, userID, testID).Scan(&visible)
+	if err != nil || !visible || policy == reviewAfterFinish {
+		return visible, err
+	}
+
+	st, err := loadAttemptStatus(q, userID, testID)
+	if err != nil {
+		return false, err
+	}
+	return st.AttemptsLeft != nil && *st.AttemptsLeft == 0, nil
+}
+
+// canAccessTest — тест доступен администратору, преподавателю курса и
+// студентам: тем, кто уже проходил тест, и тем, чья группа ведётся
+// преподавателем курса
+func canAccessTest(q queryer, role string, userID, testID int) (bool, error) {
+	if role == "admin" {
+		return true, nil
+	}
+	var ok bool
+	err := q.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM tests t JOIN courses c ON c.id = t.course_id
+                       WHERE t.id = $1 AND c.teacher_id = $2)
+            OR ($3 = 'student' AND (
+                   EXISTS(SELECT 1 FROM user_test_attempts
+                           WHERE test_id = $1 AND user_id = $2)
+                OR EXISTS(SELECT 1 FROM tests t
+                            JOIN courses c        ON c.id = t.course_id
+                            JOIN groups g         ON g.teacher_id = c.teacher_id
+                            JOIN student_groups sg ON sg.group_id = g.id
+                           WHERE t.id = $1 AND sg.student_id = $2 AND sg.removed_at IS NULL)))
+    `, testID, userID, role).Scan(&ok)
+	return ok, err
+}
+
+// sanitizeQuestion убирает из вопроса всё, что выдаёт правильный ответ
+func sanitizeQuestion(q QuestionInfo) StudentQuestionInfo {
+	out := StudentQuestionInfo{
+		ID:             q.ID,
+		TestID:         q.TestID,
+		QuestionText:   q.QuestionText,
+		QuestionType:   q.QuestionType,
+		MultipleChoice: q.MultipleChoice,
+		SetDefinitions: q.SetDefinitions,
+		Points:         q.Points,
+		Difficulty:     q.Difficulty,
+		CreatedAt:      q.CreatedAt,
+	}
+	for _, o := range q.Options {
+		out.Options = append(out.Options, StudentOptionInfo{
+			ID:         o.ID,
+			QuestionID: o.QuestionID,
+			OptionText: o.OptionText,
+			CreatedAt:  o.CreatedAt,
+		})
+	}
+	return out
+}
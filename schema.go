@@ -0,0 +1,244 @@
+package main
+
+import "log"
+
+// schemaStatements — изменения схемы БД, которые накатываются при старте.
+// Все операторы идемпотентны, поэтому выполняются при каждом запуске.
+var schemaStatements = []string{
+	// Разовые миграции данных, уже применённые к этой БД (см. schemaMigrations)
+	`CREATE TABLE IF NOT EXISTS schema_migrations (
+        name       TEXT PRIMARY KEY,
+        applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+    )`,
+
+	// Политика показа ключа ответов студентам (см. review.go)
+	`ALTER TABLE tests ADD COLUMN IF NOT EXISTS review_policy TEXT NOT NULL DEFAULT 'after_finish'`,
+	`ALTER TABLE tests ALTER COLUMN review_policy SET DEFAULT 'after_last_attempt'`,
+
+	// Множества для вопросов типа "set" (см. setquestions.go)
+	`ALTER TABLE questions ADD COLUMN IF NOT EXISTS set_definitions JSONB`,
+
+	// Шаблоны множеств и seed попытки для их экземпляров (см. templates.go)
+	`ALTER TABLE questions ADD COLUMN IF NOT EXISTS set_template JSONB`,
+	`ALTER TABLE user_test_attempts ADD COLUMN IF NOT EXISTS seed BIGINT NOT NULL DEFAULT 0`,
+
+	// Лимит времени теста в минутах (0 — без ограничения) и дедлайн попытки (см. timelimits.go)
+	`ALTER TABLE tests ADD COLUMN IF NOT EXISTS time_limit INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE user_test_attempts ADD COLUMN IF NOT EXISTS deadline_at TIMESTAMP`,
+
+	// Лимит попыток (0 — без ограничения), пауза между попытками в минутах
+	// и политика итоговой оценки (см. attemptpolicy.go)
+	`ALTER TABLE tests ADD COLUMN IF NOT EXISTS max_attempts INTEGER NOT NULL DEFAULT 2`,
+	`ALTER TABLE tests ADD COLUMN IF NOT EXISTS attempt_cooldown INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE tests ADD COLUMN IF NOT EXISTS grading_policy TEXT NOT NULL DEFAULT 'best'`,
+
+	// Перемешивание вопросов и вариантов; порядок хранится в попытке (см. ordering.go)
+	`ALTER TABLE tests ADD COLUMN IF NOT EXISTS shuffle_questions BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE tests ADD COLUMN IF NOT EXISTS shuffle_options BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE user_test_attempts ADD COLUMN IF NOT EXISTS question_order JSONB`,
+
+	// Вес вопроса, правило частичного зачёта и баллы за ответ (см. scoring.go);
+	// итог попытки — сумма баллов, поэтому score дробный
+	`ALTER TABLE questions ADD COLUMN IF NOT EXISTS points NUMERIC(6,2) NOT NULL DEFAULT 1`,
+	`ALTER TABLE questions ADD COLUMN IF NOT EXISTS scoring_rule TEXT NOT NULL DEFAULT 'all_or_nothing'`,
+	`ALTER TABLE user_question_answers ADD COLUMN IF NOT EXISTS points NUMERIC(6,2) NOT NULL DEFAULT 0`,
+	`ALTER TABLE user_test_attempts ALTER COLUMN score TYPE NUMERIC(8,2)`,
+
+	// Что именно ответил студент: выбранные варианты, текст и, для вопросов
+	// типа set, вычисленное множество
+	`ALTER TABLE user_question_answers ADD COLUMN IF NOT EXISTS selected_option_ids INTEGER[]`,
+	`ALTER TABLE user_question_answers ADD COLUMN IF NOT EXISTS answer_text TEXT`,
+	`ALTER TABLE user_question_answers ADD COLUMN IF NOT EXISTS answer_set TEXT`,
+
+	// Ручная проверка открытых ответов (см. manualgrading.go)
+	`ALTER TABLE user_question_answers ADD COLUMN IF NOT EXISTS review_status TEXT NOT NULL DEFAULT 'auto'`,
+	`ALTER TABLE user_question_answers ADD COLUMN IF NOT EXISTS reviewed_by INTEGER REFERENCES users(id)`,
+	`ALTER TABLE user_question_answers ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP`,
+	`CREATE INDEX IF NOT EXISTS user_question_answers_review_idx ON user_question_answers (review_status)`,
+
+	// Список допустимых ответов на открытый вопрос (см. openanswers.go)
+	`ALTER TABLE questions ADD COLUMN IF NOT EXISTS accepted_answers JSONB`,
+
+	// Комментарии преподавателя к попыткам и отдельным ответам (см. comments.go).
+	// question_id сохраняется отдельно: ответ может быть перезаписан.
+	`CREATE TABLE IF NOT EXISTS attempt_comments (
+        id          SERIAL PRIMARY KEY,
+        attempt_id  INTEGER NOT NULL REFERENCES user_test_attempts(id) ON DELETE CASCADE,
+        answer_id   INTEGER REFERENCES user_question_answers(id) ON DELETE SET NULL,
+        question_id INTEGER REFERENCES questions(id) ON DELETE SET NULL,
+        author_id   INTEGER NOT NULL REFERENCES users(id),
+        body        TEXT NOT NULL,
+        created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+        updated_at  TIMESTAMP,
+        read_at     TIMESTAMP
+    )`,
+	`CREATE INDEX IF NOT EXISTS attempt_comments_attempt_idx ON attempt_comments (attempt_id)`,
+
+	// Лидерборд: отказ от участия и индекс для выборки лучших попыток (см. leaderboard.go)
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS leaderboard_opt_out BOOLEAN NOT NULL DEFAULT false`,
+	`CREATE INDEX IF NOT EXISTS user_test_attempts_finished_idx ON user_test_attempts (test_id, finished_at)`,
+
+	// Какие темы теории пользователь открывал (см. progress.go)
+	`CREATE TABLE IF NOT EXISTS theory_views (
+        user_id         INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        theory_id       INTEGER NOT NULL REFERENCES theory(id) ON DELETE CASCADE,
+        first_viewed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (user_id, theory_id)
+    )`,
+	// Время чтения (секунды, по heartbeat со страницы) и отметка «изучено» (см. theoryprogress.go)
+	`ALTER TABLE theory_views ADD COLUMN IF NOT EXISTS time_spent INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE theory_views ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP`,
+	`ALTER TABLE theory_views ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP`,
+
+	// Калибровка по модели Раша (см. irt.go): сложность вопроса и подготовка
+	// студента в логитах, стандартная ошибка и число учтённых ответов
+	`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_difficulty DOUBLE PRECISION`,
+	`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_se DOUBLE PRECISION`,
+	`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_responses INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_calibrated_at TIMESTAMP`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS irt_ability DOUBLE PRECISION`,
+
+	// Политика пересчёта сложности — одна строка (см. difficulty.go)
+	`CREATE TABLE IF NOT EXISTS difficulty_policy (
+        id          BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+        method      TEXT NOT NULL DEFAULT 'ratio',
+        min_answers INTEGER NOT NULL DEFAULT 50,
+        easy_share  DOUBLE PRECISION NOT NULL DEFAULT 0.7,
+        hard_share  DOUBLE PRECISION NOT NULL DEFAULT 0.3,
+        schedule    TEXT NOT NULL DEFAULT '0 3 * * *',
+        updated_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+        updated_by  INTEGER REFERENCES users(id) ON DELETE SET NULL
+    )`,
+	`ALTER TABLE difficulty_policy ALTER COLUMN method SET DEFAULT 'ratio'`,
+	`INSERT INTO difficulty_policy (id) VALUES (true) ON CONFLICT DO NOTHING`,
+	// История пересчётов с прежними значениями для отката
+	`CREATE TABLE IF NOT EXISTS difficulty_recalc_runs (
+        id             SERIAL PRIMARY KEY,
+        method         TEXT NOT NULL,
+        policy         JSONB NOT NULL,
+        started_by     INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        changed        INTEGER NOT NULL DEFAULT 0,
+        created_at     TIMESTAMP NOT NULL DEFAULT NOW(),
+        rolled_back_at TIMESTAMP,
+        rolled_back_by INTEGER REFERENCES users(id) ON DELETE SET NULL
+    )`,
+	`CREATE TABLE IF NOT EXISTS difficulty_recalc_changes (
+        run_id             INTEGER NOT NULL REFERENCES difficulty_recalc_runs(id) ON DELETE CASCADE,
+        question_id        INTEGER NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+        answers            INTEGER NOT NULL,
+        old_difficulty     TEXT,
+        new_difficulty     TEXT,
+        old_irt_difficulty DOUBLE PRECISION,
+        old_irt_se         DOUBLE PRECISION,
+        new_irt_difficulty DOUBLE PRECISION,
+        PRIMARY KEY (run_id, question_id)
+    )`,
+
+	// Очередь предсказания сложности ML-сервисом (см. difficultyjobs.go)
+	`CREATE TABLE IF NOT EXISTS difficulty_batches (
+        id         SERIAL PRIMARY KEY,
+        created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        total      INTEGER NOT NULL DEFAULT 0,
+        created_at TIMESTAMP NOT NULL DEFAULT NOW()
+    )`,
+	`CREATE TABLE IF NOT EXISTS difficulty_jobs (
+        id          SERIAL PRIMARY KEY,
+        question_id INTEGER NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+        batch_id    INTEGER REFERENCES difficulty_batches(id) ON DELETE CASCADE,
+        status      TEXT NOT NULL DEFAULT 'queued',
+        attempts    INTEGER NOT NULL DEFAULT 0,
+        last_error  TEXT,
+        run_after   TIMESTAMP NOT NULL DEFAULT NOW(),
+        created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+        started_at  TIMESTAMP,
+        finished_at TIMESTAMP
+    )`,
+	`CREATE INDEX IF NOT EXISTS difficulty_jobs_status_idx ON difficulty_jobs (status, run_after)`,
+	`CREATE INDEX IF NOT EXISTS difficulty_jobs_batch_idx ON difficulty_jobs (batch_id)`,
+}
+
+// schemaMigration — разовое изменение данных. В отличие от schemaStatements
+// выполняется один раз: имя применённой миграции записывается в schema_migrations.
+type schemaMigration struct {
+	name  string
+	stmts []string
+}
+
+var schemaMigrations = []schemaMigration{
+	// Ответы, записанные до появления весов, хранили только is_correct:
+	// начисляем им вес вопроса и пересчитываем итоги затронутых попыток
+	{"answer_points_backfill", []string{
+		`UPDATE user_question_answers a
+            SET points = q.points
+           FROM questions q
+          WHERE q.id = a.question_id AND a.is_correct AND a.points = 0`,
+		`UPDATE user_test_attempts t
+            SET score = s.total
+           FROM (SELECT attempt_id, SUM(points) AS total
+                   FROM user_question_answers
+                  WHERE attempt_id IS NOT NULL
+                  GROUP BY attempt_id) s
+          WHERE s.attempt_id = t.id AND t.score IS DISTINCT FROM s.total`,
+	}},
+	// after_finish раскрывал ключ между попытками; тестам, получившим его
+	// по умолчанию, ставим новую политику по умолчанию
+	{"review_policy_after_last_attempt", []string{
+		`UPDATE tests SET review_policy = 'after_last_attempt' WHERE review_policy = 'after_finish'`,
+	}},
+	// Комментарий при ручной проверке раньше хранился в teacher_comment и не
+	// попадал в ленту отзывов; переносим его в attempt_comments. ADD COLUMN —
+	// чтобы миграция проходила и на БД, где колонки никогда не было.
+	{"teacher_comment_to_attempt_comments", []string{
+		`ALTER TABLE user_question_answers ADD COLUMN IF NOT EXISTS teacher_comment TEXT`,
+		`INSERT INTO attempt_comments (attempt_id, answer_id, question_id, author_id, body, created_at, updated_at)
+         SELECT attempt_id, id, question_id, reviewed_by, teacher_comment, reviewed_at, reviewed_at
+           FROM user_question_answers
+          WHERE teacher_comment IS NOT NULL AND attempt_id IS NOT NULL
+            AND reviewed_by IS NOT NULL AND reviewed_at IS NOT NULL`,
+		`ALTER TABLE user_question_answers DROP COLUMN teacher_comment`,
+	}},
+	// По умолчанию сложность пересчитывается по доле верных ответов; irt
+	// остаётся только там, где его выбрал администратор (updated_by задан)
+	{"difficulty_policy_default_ratio", []string{
+		`UPDATE difficulty_policy SET method = 'ratio' WHERE method = 'irt' AND updated_by IS NULL`,
+	}},
+}
+
+// ensureSchema применяет schemaStatements и ещё не применённые
+// schemaMigrations; при ошибке сервер не стартует
+func ensureSchema() {
+	for _, stmt := range schemaStatements {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Fatalf("ensureSchema: %v\n%s", err, stmt)
+		}
+	}
+	for _, m := range schemaMigrations {
+		if err := applyMigration(m); err != nil {
+			log.Fatalf("ensureSchema: миграция %s: %v", m.name, err)
+		}
+	}
+}
+
+// applyMigration выполняет миграцию в одной транзакции вместе с отметкой о
+// ней; если отметка уже есть, ничего не делает
+func applyMigration(m schemaMigration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO schema_migrations (name) VALUES ($1) ON CONFLICT DO NOTHING`, m.name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	for _, stmt := range m.stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	log.Println("ensureSchema: применена миграция", m.name)
+	return tx.Commit()
+}
@@ -0,0 +1,75 @@
+package main
+
+// Правила частичного зачёта для вопросов с несколькими правильными
+// вариантами (questions.scoring_rule). Для вопросов с одним вариантом
+// все правила дают одно и то же: либо полный балл, либо ноль.
+const (
+	// полный балл только за точное совпадение с правильными вариантами
+	scoringAllOrNothing = "all_or_nothing"
+	// доля вариантов, по которым студент принял верное решение
+	// (отметил правильный или не отметил неправильный); ноль, если не
+	// отмечен ни один правильный — иначе пустой ответ получал бы баллы
+	// за каждый неотмеченный неправильный вариант
+	scoringProportional = "proportional"
+	// (верно отмеченные − ошибочно отмеченные) / число правильных, не меньше нуля
+	scoringRightMinusWrong = "right_minus_wrong"
+)
+
+// defaultQuestionPoints — вес вопроса, если преподаватель его не задал
+const defaultQuestionPoints = 1.0
+
+func validScoringRule(r string) bool {
+	return r == scoringAllOrNothing || r == scoringProportional || r == scoringRightMinusWrong
+}
+
+func validQuestionPoints(p float64) bool {
+	return p > 0 && p <= 100
+}
+
+// closedCredit вычисляет долю балла (от 0 до 1) за выбранные варианты.
+// options — все варианты вопроса: id → правильный ли он.
+func closedCredit(rule string, multiple bool, options map[int]bool, selected []int) float64 {
+	chosen := map[int]bool{}
+	for _, id := range selected {
+		if _, ok := options[id]; ok {
+			chosen[id] = true
+		}
+	}
+
+	var right, wrong, total, decided int
+	for id, isCorrect := range options {
+		if isCorrect {
+			total++
+		}
+		switch {
+		case chosen[id] && isCorrect:
+			right++
+			decided++
+		case chosen[id]:
+			wrong++
+		case !isCorrect:
+			decided++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	exact := right == total && wrong == 0
+	if !multiple || rule == scoringAllOrNothing || rule == "" {
+		if exact {
+			return 1
+		}
+		return 0
+	}
+	switch rule {
+	case scoringProportional:
+		if right == 0 {
+			return 0
+		}
+		return float64(decided) / float64(len(options))
+	case scoringRightMinusWrong:
+		return max(float64(right-wrong)/float64(total), 0)
+	}
+	return 0
+}
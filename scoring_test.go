@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestClosedCredit(t *testing.T) {
+	// 1 и 2 — правильные варианты, 3 и 4 — неправильные
+	multi := map[int]bool{1: true, 2: true, 3: false, 4: false}
+	single := map[int]bool{1: true, 2: false, 3: false}
+
+	tests := []struct {
+		name     string
+		rule     string
+		multiple bool
+		options  map[int]bool
+		selected []int
+		want     float64
+	}{
+		{"all_or_nothing точно", scoringAllOrNothing, true, multi, []int{1, 2}, 1},
+		{"all_or_nothing не все", scoringAllOrNothing, true, multi, []int{1}, 0},
+		{"all_or_nothing лишний", scoringAllOrNothing, true, multi, []int{1, 2, 3}, 0},
+		{"пустое правило = all_or_nothing", "", true, multi, []int{1}, 0},
+		{"чужой id не учитывается", scoringAllOrNothing, true, multi, []int{1, 2, 99}, 1},
+
+		{"proportional точно", scoringProportional, true, multi, []int{1, 2}, 1},
+		{"proportional один правильный", scoringProportional, true, multi, []int{1}, 0.75},
+		{"proportional правильный и неправильный", scoringProportional, true, multi, []int{1, 3}, 0.5},
+		{"proportional только неправильный", scoringProportional, true, multi, []int{3}, 0},
+		{"proportional пустой ответ", scoringProportional, true, multi, nil, 0},
+
+		{"right_minus_wrong точно", scoringRightMinusWrong, true, multi, []int{1, 2}, 1},
+		{"right_minus_wrong один правильный", scoringRightMinusWrong, true, multi, []int{1}, 0.5},
+		{"right_minus_wrong поровну", scoringRightMinusWrong, true, multi, []int{1, 3}, 0},
+		{"right_minus_wrong все и лишний", scoringRightMinusWrong, true, multi, []int{1, 2, 3}, 0.5},
+		{"right_minus_wrong не меньше нуля", scoringRightMinusWrong, true, multi, []int{3, 4}, 0},
+
+		// с одним правильным вариантом правило не важно
+		{"single верно", scoringProportional, false, single, []int{1}, 1},
+		{"single неверно", scoringProportional, false, single, []int{2}, 0},
+		{"single пусто", scoringRightMinusWrong, false, single, nil, 0},
+
+		{"нет правильных вариантов", scoringProportional, true, map[int]bool{1: false, 2: false}, nil, 0},
+	}
+	for _, tt := range tests {
+		if got := closedCredit(tt.rule, tt.multiple, tt.options, tt.selected); got != tt.want {
+			t.Errorf("%s: closedCredit(%s, %v) = %v, want %v", tt.name, tt.rule, tt.selected, got, tt.want)
+		}
+	}
+}
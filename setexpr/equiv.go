@@ -0,0 +1,154 @@
+package setexpr
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxVars — сколько различных множеств допускается при символьной проверке
+// (перебираются все 2^n областей диаграммы Эйлера–Венна)
+const MaxVars = 8
+
+var (
+	ErrTooManyVars = fmt.Errorf("слишком много множеств: допускается не больше %d", MaxVars)
+	ErrLiteral     = errors.New("в тождестве нельзя использовать конкретные элементы, только имена множеств и ∅")
+)
+
+// Region — одна область диаграммы Эйлера–Венна: для каждого множества
+// указано, лежат ли её элементы в нём
+type Region map[string]bool
+
+// String записывает область как пересечение, например A ∩ B' ∩ C
+func (r Region) String() string {
+	names := make([]string, 0, len(r))
+	for n := range r {
+		names = append(names, n)
+	}
+	if len(names) == 0 {
+		return "U"
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, n := range names {
+		if r[n] {
+			parts[i] = n
+		} else {
+			parts[i] = n + "'"
+		}
+	}
+	return strings.Join(parts, " ∩ ")
+}
+
+// Vars возвращает имена множеств выражения по алфавиту (без универсума U)
+func Vars(exprs ...Expr) []string {
+	seen := map[string]bool{}
+	var walk func(Expr)
+	walk = func(e Expr) {
+		switch x := e.(type) {
+		case Var:
+			if x.Name != "U" {
+				seen[x.Name] = true
+			}
+		case Complement:
+			walk(x.X)
+		case Binary:
+			walk(x.L)
+			walk(x.R)
+		}
+	}
+	for _, e := range exprs {
+		walk(e)
+	}
+	out := make([]string, 0, len(seen))
+	for n := range seen {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Regions перечисляет все 2^n областей для заданных множеств
+func Regions(vars []string) []Region {
+	out := make([]Region, 0, 1<<len(vars))
+	for mask := 0; mask < 1<<len(vars); mask++ {
+		r := Region{}
+		for i, v := range vars {
+			r[v] = mask&(1<<i) != 0
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// Member сообщает, входит ли область r в множество, заданное выражением
+func Member(e Expr, r Region) (bool, error) {
+	switch x := e.(type) {
+	case Var:
+		if x.Name == "U" {
+			return true, nil
+		}
+		return r[x.Name], nil
+	case Literal:
+		if x.Set.Len() == 0 {
+			return false, nil
+		}
+		return false, ErrLiteral
+	case Complement:
+		in, err := Member(x.X, r)
+		return !in, err
+	case Binary:
+		l, err := Member(x.L, r)
+		if err != nil {
+			return false, err
+		}
+		rr, err := Member(x.R, r)
+		if err != nil {
+			return false, err
+		}
+		switch x.Op {
+		case OpUnion:
+			return l || rr, nil
+		case OpIntersect:
+			return l && rr, nil
+		case OpDifference:
+			return l && !rr, nil
+		default:
+			return l != rr, nil
+		}
+	}
+	return false, fmt.Errorf("неизвестный узел %T", e)
+}
+
+// Counterexample — область, в которой выражения расходятся
+type Counterexample struct {
+	Region Region
+	// InLeft — элементы области входят в левое выражение, но не в правое
+	// (иначе — наоборот)
+	InLeft bool
+}
+
+// Equivalent проверяет, что выражения задают одно и то же множество
+// при любых значениях входящих в них множеств. Если нет — возвращает
+// область-контрпример.
+func Equivalent(a, b Expr) (bool, *Counterexample, error) {
+	vars := Vars(a, b)
+	if len(vars) > MaxVars {
+		return false, nil, ErrTooManyVars
+	}
+	for _, r := range Regions(vars) {
+		inA, err := Member(a, r)
+		if err != nil {
+			return false, nil, err
+		}
+		inB, err := Member(b, r)
+		if err != nil {
+			return false, nil, err
+		}
+		if inA != inB {
+			return false, &Counterexample{Region: r, InLeft: inA}, nil
+		}
+	}
+	return true, nil, nil
+}
@@ -0,0 +1,89 @@
+package setexpr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEquivalent(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"A ∪ B", "B ∪ A", true},
+		{"(A ∪ B) ∪ C", "A ∪ (B ∪ C)", true},
+		{"A ∩ (B ∪ C)", "(A ∩ B) ∪ (A ∩ C)", true},
+		{"(A ∪ B)'", "A' ∩ B'", true},
+		{"(A ∩ B)'", "A' ∪ B'", true},
+		{"A \\ B", "A ∩ B'", true},
+		{"A Δ B", "(A \\ B) ∪ (B \\ A)", true},
+		{"A''", "A", true},
+		{"A ∪ A'", "U", true},
+		{"A ∩ A'", "∅", true},
+		{"A ∪ ∅", "A", true},
+		// множество, которого нет в одном из выражений, тоже учитывается
+		{"A ∪ (A ∩ B)", "A", true},
+		{"A ∪ B", "A ∩ B", false},
+		{"A \\ B", "B \\ A", false},
+		{"A ∪ B ∩ C", "(A ∪ B) ∩ C", false},
+		{"A", "B", false},
+	}
+	for _, tt := range tests {
+		a, err := Parse(tt.a)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.a, err)
+		}
+		b, err := Parse(tt.b)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.b, err)
+		}
+		got, ce, err := Equivalent(a, b)
+		if err != nil {
+			t.Errorf("Equivalent(%s, %s): %v", tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Equivalent(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+			continue
+		}
+		if got {
+			if ce != nil {
+				t.Errorf("Equivalent(%s, %s): контрпример %v у равносильных выражений", tt.a, tt.b, ce.Region)
+			}
+			continue
+		}
+		// контрпример должен действительно различать выражения
+		if ce == nil {
+			t.Errorf("Equivalent(%s, %s): нет контрпримера", tt.a, tt.b)
+			continue
+		}
+		inA, _ := Member(a, ce.Region)
+		inB, _ := Member(b, ce.Region)
+		if inA == inB || inA != ce.InLeft {
+			t.Errorf("Equivalent(%s, %s): область %v не различает выражения", tt.a, tt.b, ce.Region)
+		}
+	}
+}
+
+func TestEquivalentErrors(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want error
+	}{
+		{"A ∪ {1}", "A", ErrLiteral},
+		{"A ∪ B ∪ C ∪ D ∪ E", "F ∪ G ∪ H ∪ I", ErrTooManyVars},
+	}
+	for _, tt := range tests {
+		a, err := Parse(tt.a)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.a, err)
+		}
+		b, err := Parse(tt.b)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.b, err)
+		}
+		if _, _, err := Equivalent(a, b); !errors.Is(err, tt.want) {
+			t.Errorf("Equivalent(%s, %s): err = %v, want %v", tt.a, tt.b, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package setexpr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Op — операция над множествами
+type Op int
+
+const (
+	OpUnion Op = iota
+	OpIntersect
+	OpDifference
+	OpSymDiff
+)
+
+// Symbol — каноническая запись операции
+func (op Op) Symbol() string {
+	switch op {
+	case OpUnion:
+		return "∪"
+	case OpIntersect:
+		return "∩"
+	case OpDifference:
+		return "\\"
+	case OpSymDiff:
+		return "Δ"
+	}
+	return "?"
+}
+
+// приоритет: пересечение связывает сильнее объединения, разности и Δ
+func (op Op) precedence() int {
+	if op == OpIntersect {
+		return 2
+	}
+	return 1
+}
+
+// apply выполняет операцию над двумя множествами
+func (op Op) apply(l, r Set) Set {
+	switch op {
+	case OpUnion:
+		return l.Union(r)
+	case OpIntersect:
+		return l.Intersect(r)
+	case OpDifference:
+		return l.Difference(r)
+	default:
+		return l.SymmetricDifference(r)
+	}
+}
+
+// ErrNoUniverse возвращается при вычислении дополнения без заданного универсума
+var ErrNoUniverse = errors.New("для дополнения нужен универсум U")
+
+// Env — значения переменных, на которых вычисляется выражение
+type Env struct {
+	Sets     map[string]Set
+	Universe Set // nil — универсум не задан, дополнение недоступно
+}
+
+// Expr — узел синтаксического дерева выражения
+type Expr interface {
+	Eval(env Env) (Set, error)
+	String() string
+}
+
+// Var — именованное множество (A, B, C, …); U без явного значения — универсум
+type Var struct {
+	Name string
+}
+
+func (v Var) Eval(env Env) (Set, error) {
+	if s, ok := env.Sets[v.Name]; ok {
+		return s, nil
+	}
+	if v.Name == "U" && env.Universe != nil {
+		return env.Universe, nil
+	}
+	return nil, fmt.Errorf("неизвестное множество %q", v.Name)
+}
+
+func (v Var) String() string { return v.Name }
+
+// Literal — множество, записанное перечислением: {1, 2, 3}
+type Literal struct {
+	Set Set
+}
+
+func (l Literal) Eval(Env) (Set, error) { return l.Set, nil }
+
+func (l Literal) String() string { return l.Set.String() }
+
+// Complement — дополнение до универсума
+type Complement struct {
+	X Expr
+}
+
+func (c Complement) Eval(env Env) (Set, error) {
+	if env.Universe == nil {
+		return nil, ErrNoUniverse
+	}
+	x, err := c.X.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return env.Universe.Difference(x), nil
+}
+
+func (c Complement) String() string {
+	if _, ok := c.X.(Binary); ok {
+		return "(" + c.X.String() + ")'"
+	}
+	return c.X.String() + "'"
+}
+
+// Binary — бинарная операция
+type Binary struct {
+	Op   Op
+	L, R Expr
+}
+
+func (b Binary) Eval(env Env) (Set, error) {
+	l, err := b.L.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.R.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return b.Op.apply(l, r), nil
+}
+
+// String печатает выражение, заключая вложенные операции в скобки.
+// Скобки опускаются только вокруг более сильной операции (A ∩ B ∪ C),
+// поэтому (A ∪ B) ∪ C и A ∪ (B ∪ C) печатаются по-разному.
+func (b Binary) String() string {
+	return b.operand(b.L) + " " + b.Op.Symbol() + " " + b.operand(b.R)
+}
+
+func (b Binary) operand(e Expr) string {
+	if c, ok := e.(Binary); ok && c.Op.precedence() <= b.Op.precedence() {
+		return "(" + c.String() + ")"
+	}
+	return e.String()
+}
+
+// Eval разбирает и вычисляет выражение за один вызов
+func Eval(src string, env Env) (Set, error) {
+	e, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return e.Eval(env)
+}
@@ -0,0 +1,289 @@
+package setexpr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Грамматика (пересечение связывает сильнее остальных бинарных операций,
+// все бинарные операции левоассоциативны):
+//
+//	expr    = term { ("∪" | "\" | "Δ") term }
+//	term    = factor { "∩" factor }
+//	factor  = ("¬" | "~") factor | primary { "'" }
+//	primary = имя | "{" элементы "}" | "∅" | "(" expr ")"
+//
+// Допустимые ASCII-замены: объединение — | или +, пересечение — & или *,
+// разность — - или ∖, симметрическая разность — ^, ⊕, ∆ или △,
+// дополнение — постфиксный ' или ᶜ. В перечислении можно писать
+// целочисленные диапазоны: {1..10}.
+
+// SyntaxError — ошибка разбора с позицией (в символах от начала строки)
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("ошибка в выражении (позиция %d): %s", e.Pos+1, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokLiteral
+	tokBinOp
+	tokPrefixNot
+	tokPostfixNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	pos  int
+	text string
+	op   Op
+	set  Set
+}
+
+var binOps = map[rune]Op{
+	'∪': OpUnion, '|': OpUnion, '+': OpUnion,
+	'∩': OpIntersect, '&': OpIntersect, '*': OpIntersect,
+	'\\': OpDifference, '-': OpDifference, '−': OpDifference, '∖': OpDifference,
+	'Δ': OpSymDiff, '∆': OpSymDiff, '△': OpSymDiff, '⊕': OpSymDiff, '^': OpSymDiff,
+}
+
+// isBinOp проверяется раньше букв, т.к. Δ — греческая буква
+func isBinOp(r rune) bool {
+	_, ok := binOps[r]
+	return ok
+}
+
+func tokenize(src string) ([]token, error) {
+	rs := []rune(src)
+	var toks []token
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, token{kind: tokLParen, pos: i})
+			i++
+		case r == ')':
+			toks = append(toks, token{kind: tokRParen, pos: i})
+			i++
+		case r == '¬' || r == '~' || r == '!':
+			toks = append(toks, token{kind: tokPrefixNot, pos: i})
+			i++
+		case r == '\'' || r == '’' || r == 'ᶜ':
+			toks = append(toks, token{kind: tokPostfixNot, pos: i})
+			i++
+		case r == '∅':
+			toks = append(toks, token{kind: tokLiteral, pos: i, set: Set{}})
+			i++
+		case r == '{':
+			end := i + 1
+			for end < len(rs) && rs[end] != '}' {
+				end++
+			}
+			if end == len(rs) {
+				return nil, &SyntaxError{Pos: i, Msg: "не закрыта фигурная скобка"}
+			}
+			set, err := parseElements(string(rs[i+1 : end]))
+			if err != nil {
+				return nil, &SyntaxError{Pos: i, Msg: err.Error()}
+			}
+			toks = append(toks, token{kind: tokLiteral, pos: i, set: set})
+			i = end + 1
+		case isBinOp(r):
+			toks = append(toks, token{kind: tokBinOp, pos: i, op: binOps[r]})
+			i++
+		case unicode.IsLetter(r):
+			start := i
+			// ᶜ — тоже буква, но в имени это постфиксное дополнение: Aᶜ
+			for i < len(rs) && rs[i] != 'ᶜ' && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_') {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, pos: start, text: string(rs[start:i])})
+		default:
+			return nil, &SyntaxError{Pos: i, Msg: fmt.Sprintf("неизвестный символ %q", r)}
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(rs)}), nil
+}
+
+// parseElements разбирает содержимое фигурных скобок: "1, 2, 5..7"
+func parseElements(body string) (Set, error) {
+	s := Set{}
+	if strings.TrimSpace(body) == "" {
+		return s, nil
+	}
+	ranged := 0 // элементов из всех диапазонов перечисления
+	for _, part := range strings.Split(body, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("пустой элемент в перечислении")
+		}
+		if lo, hi, ok := strings.Cut(part, ".."); ok {
+			from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+			to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+			if err1 != nil || err2 != nil || from > to {
+				return nil, fmt.Errorf("некорректный диапазон %q", part)
+			}
+			// границы проверяются до вычитания, иначе to-from переполнится
+			if from < -maxRangeBound || to > maxRangeBound {
+				return nil, fmt.Errorf("границы диапазона %q вне [-%d, %d]", part, maxRangeBound, maxRangeBound)
+			}
+			count := to - from + 1
+			ranged += count
+			if count > maxRange || ranged > maxRange {
+				return nil, fmt.Errorf("слишком большой диапазон %q", part)
+			}
+			for i := 0; i < count; i++ {
+				s.Add(strconv.Itoa(from + i))
+			}
+			continue
+		}
+		s.Add(part)
+	}
+	return s, nil
+}
+
+// Ограничения диапазонов вида {a..b}, чтобы не раздувать память:
+// maxRange — сколько элементов дают все диапазоны одного перечисления,
+// maxRangeBound — допустимые значения границ
+const (
+	maxRange      = 10000
+	maxRangeBound = 1000000
+)
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// Parse разбирает выражение над множествами
+func Parse(src string) (Expr, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &SyntaxError{Pos: t.pos, Msg: "лишние символы в конце выражения"}
+	}
+	return e, nil
+}
+
+// ParseSet разбирает множество, записанное перечислением: {1, 2, 3}
+func ParseSet(src string) (Set, error) {
+	e, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	lit, ok := e.(Literal)
+	if !ok {
+		return nil, &SyntaxError{Pos: 0, Msg: "ожидалось перечисление элементов в фигурных скобках"}
+	}
+	return lit.Set, nil
+}
+
+func (p *parser) expr() (Expr, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokBinOp || t.op == OpIntersect {
+			return left, nil
+		}
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: t.op, L: left, R: right}
+	}
+}
+
+func (p *parser) term() (Expr, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokBinOp || t.op != OpIntersect {
+			return left, nil
+		}
+		p.next()
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: OpIntersect, L: left, R: right}
+	}
+}
+
+func (p *parser) factor() (Expr, error) {
+	if p.peek().kind == tokPrefixNot {
+		p.next()
+		x, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return Complement{X: x}, nil
+	}
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokPostfixNot {
+		p.next()
+		x = Complement{X: x}
+	}
+	return x, nil
+}
+
+func (p *parser) primary() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokIdent:
+		return Var{Name: t.text}, nil
+	case tokLiteral:
+		return Literal{Set: t.set}, nil
+	case tokLParen:
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, &SyntaxError{Pos: c.pos, Msg: "ожидалась закрывающая скобка"}
+		}
+		return e, nil
+	case tokEOF:
+		return nil, &SyntaxError{Pos: t.pos, Msg: "неожиданный конец выражения"}
+	}
+	return nil, &SyntaxError{Pos: t.pos, Msg: "ожидалось множество или открывающая скобка"}
+}
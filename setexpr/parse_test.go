@@ -0,0 +1,162 @@
+package setexpr
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // запись разобранного выражения
+	}{
+		{"A", "A"},
+		{"A ∪ B", "A ∪ B"},
+		{"A | B", "A ∪ B"},
+		{"A + B", "A ∪ B"},
+		{"A & B", "A ∩ B"},
+		{"A * B", "A ∩ B"},
+		{"A - B", "A \\ B"},
+		{"A ∖ B", "A \\ B"},
+		{"A ^ B", "A Δ B"},
+		{"A ⊕ B", "A Δ B"},
+		// пересечение связывает сильнее объединения
+		{"A ∪ B ∩ C", "A ∪ B ∩ C"},
+		{"(A ∪ B) ∩ C", "(A ∪ B) ∩ C"},
+		// бинарные операции левоассоциативны
+		{"A ∪ B ∪ C", "(A ∪ B) ∪ C"},
+		{"A ∪ (B ∪ C)", "A ∪ (B ∪ C)"},
+		{"A \\ B \\ C", "(A \\ B) \\ C"},
+		// дополнение — префиксное и постфиксное
+		{"A'", "A'"},
+		{"¬A", "A'"},
+		{"~A", "A'"},
+		{"Aᶜ", "A'"},
+		{"(A ∪ B)'", "(A ∪ B)'"},
+		{"A''", "A''"},
+		{"{1, 2, 3}", "{1, 2, 3}"},
+		{"{3, 1, 2, 1}", "{1, 2, 3}"},
+		{"{1..4}", "{1, 2, 3, 4}"},
+		{"{01, 2}", "{1, 2}"},
+		{"∅", "{}"},
+		{"A ∩ {1, 2}", "A ∩ {1, 2}"},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.src, err)
+			continue
+		}
+		if got := e.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int // позиция ошибки в символах
+	}{
+		{"", 0},
+		{"A ∪", 3},
+		{"∪ A", 0},
+		{"(A ∪ B", 6},
+		{"A ∪ B)", 5},
+		{"A B", 2},
+		{"{1, 2", 0},
+		{"A ∪ #", 4},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("Parse(%q): err = %v, want *SyntaxError", tt.src, err)
+			continue
+		}
+		if se.Pos != tt.pos {
+			t.Errorf("Parse(%q): позиция %d, want %d (%v)", tt.src, se.Pos, tt.pos, err)
+		}
+	}
+}
+
+func TestParseSet(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{"{1, 2, 3}", "{1, 2, 3}", false},
+		{"{1..3, 5}", "{1, 2, 3, 5}", false},
+		{"∅", "{}", false},
+		{"A", "", true},
+		{"{1} ∪ {2}", "", true},
+	}
+	for _, tt := range tests {
+		s, err := ParseSet(tt.src)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSet(%q) = %s, want error", tt.src, s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSet(%q): %v", tt.src, err)
+			continue
+		}
+		if got := s.String(); got != tt.want {
+			t.Errorf("ParseSet(%q) = %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+// Диапазоны с огромными границами должны отклоняться сразу, а не
+// переполнять to-from или зацикливаться на n <= MaxInt64
+func TestParseSetRangeLimits(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantLen int
+		wantErr bool
+	}{
+		{"{1..10000}", 10000, false},
+		{"{-1000000..-999001}", 1000, false},
+		{"{1..10001}", 0, true},
+		{"{-9223372036854775808..9223372036854775807}", 0, true},
+		{"{9223372036854775806..9223372036854775807}", 0, true},
+		{"{-9223372036854775808..-9223372036854775807}", 0, true},
+		{"{1000000..1000001}", 0, true},
+		// ограничение — на все диапазоны перечисления вместе
+		{"{1..6000, 10001..16000}", 0, true},
+		{"{1..5000, 10001..15000}", 10000, false},
+	}
+	for _, tt := range tests {
+		done := make(chan struct{})
+		var (
+			s   Set
+			err error
+		)
+		go func() {
+			s, err = ParseSet(tt.src)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("ParseSet(%q) не завершился", tt.src)
+		}
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSet(%q): %d элементов, want error", tt.src, s.Len())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSet(%q): %v", tt.src, err)
+			continue
+		}
+		if s.Len() != tt.wantLen {
+			t.Errorf("ParseSet(%q): %d элементов, want %d", tt.src, s.Len(), tt.wantLen)
+		}
+	}
+}
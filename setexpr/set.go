@@ -0,0 +1,120 @@
+// Package setexpr — разбор и вычисление выражений алгебры множеств:
+// объединение, пересечение, разность, симметрическая разность,
+// дополнение до универсума и скобки.
+package setexpr
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Set — конечное множество элементов. Элементы хранятся строками;
+// целые числа нормализуются, поэтому {01, 1} — это {1}.
+type Set map[string]struct{}
+
+// NewSet создаёт множество из перечисленных элементов
+func NewSet(elems ...string) Set {
+	s := Set{}
+	for _, e := range elems {
+		s.Add(e)
+	}
+	return s
+}
+
+// Add добавляет элемент (с нормализацией)
+func (s Set) Add(elem string) {
+	s[normalizeElem(elem)] = struct{}{}
+}
+
+// Contains проверяет принадлежность элемента множеству
+func (s Set) Contains(elem string) bool {
+	_, ok := s[normalizeElem(elem)]
+	return ok
+}
+
+func (s Set) Len() int { return len(s) }
+
+func (s Set) Union(t Set) Set {
+	out := Set{}
+	for e := range s {
+		out[e] = struct{}{}
+	}
+	for e := range t {
+		out[e] = struct{}{}
+	}
+	return out
+}
+
+func (s Set) Intersect(t Set) Set {
+	out := Set{}
+	for e := range s {
+		if _, ok := t[e]; ok {
+			out[e] = struct{}{}
+		}
+	}
+	return out
+}
+
+func (s Set) Difference(t Set) Set {
+	out := Set{}
+	for e := range s {
+		if _, ok := t[e]; !ok {
+			out[e] = struct{}{}
+		}
+	}
+	return out
+}
+
+func (s Set) SymmetricDifference(t Set) Set {
+	return s.Difference(t).Union(t.Difference(s))
+}
+
+// Equal — равенство множеств (порядок и повторы элементов не важны)
+func (s Set) Equal(t Set) bool {
+	if len(s) != len(t) {
+		return false
+	}
+	for e := range s {
+		if _, ok := t[e]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Elements возвращает элементы в устойчивом порядке:
+// сначала числа по возрастанию, затем остальные строки по алфавиту
+func (s Set) Elements() []string {
+	out := make([]string, 0, len(s))
+	for e := range s {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, aErr := strconv.Atoi(out[i])
+		b, bErr := strconv.Atoi(out[j])
+		switch {
+		case aErr == nil && bErr == nil:
+			return a < b
+		case aErr == nil:
+			return true
+		case bErr == nil:
+			return false
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// String — запись множества перечислением, например {1, 2, 3}
+func (s Set) String() string {
+	return "{" + strings.Join(s.Elements(), ", ") + "}"
+}
+
+func normalizeElem(e string) string {
+	e = strings.TrimSpace(e)
+	if n, err := strconv.Atoi(e); err == nil {
+		return strconv.Itoa(n)
+	}
+	return e
+}
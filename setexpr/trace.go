@@ -0,0 +1,99 @@
+package setexpr
+
+// Step — один шаг пошагового вычисления: подвыражение и его значение
+type Step struct {
+	Index    int      `json:"index"`
+	Expr     string   `json:"expr"`
+	Op       string   `json:"op,omitempty"`       // ∪, ∩, \, Δ или ' ; пусто для множеств и перечислений
+	Operands []int    `json:"operands,omitempty"` // номера шагов-операндов
+	Elements []string `json:"elements"`
+	Set      string   `json:"set"`
+
+	value Set
+}
+
+// Trace вычисляет выражение снизу вверх и возвращает шаги в порядке
+// вычисления: сначала операнды, затем операция над ними. Одинаковые
+// подвыражения вычисляются один раз. Последний шаг — значение всего выражения.
+func Trace(e Expr, env Env) ([]Step, error) {
+	t := &tracer{env: env, seen: map[string]int{}}
+	if _, err := t.visit(e); err != nil {
+		return nil, err
+	}
+	return t.steps, nil
+}
+
+type tracer struct {
+	env   Env
+	steps []Step
+	seen  map[string]int
+}
+
+func (t *tracer) visit(e Expr) (int, error) {
+	key := e.String()
+	if i, ok := t.seen[key]; ok {
+		return i, nil
+	}
+
+	step := Step{Expr: key}
+	switch x := e.(type) {
+	case Complement:
+		if t.env.Universe == nil {
+			return 0, ErrNoUniverse
+		}
+		i, err := t.visit(x.X)
+		if err != nil {
+			return 0, err
+		}
+		step.Op = "'"
+		step.Operands = []int{i}
+		step.value = t.env.Universe.Difference(t.steps[i].value)
+	case Binary:
+		l, err := t.visit(x.L)
+		if err != nil {
+			return 0, err
+		}
+		r, err := t.visit(x.R)
+		if err != nil {
+			return 0, err
+		}
+		step.Op = x.Op.Symbol()
+		step.Operands = []int{l, r}
+		step.value = x.Op.apply(t.steps[l].value, t.steps[r].value)
+	default:
+		s, err := e.Eval(t.env)
+		if err != nil {
+			return 0, err
+		}
+		step.value = s
+	}
+
+	step.Index = len(t.steps)
+	step.Elements = step.value.Elements()
+	step.Set = step.value.String()
+	t.steps = append(t.steps, step)
+	t.seen[key] = step.Index
+	return step.Index, nil
+}
+
+// Divergence ищет первый шаг-операцию, значение которого не встречается
+// ни на одном шаге эталонного вычисления ref. Это место, где ход решения
+// студента разошёлся с эталонным. -1 — расхождения нет.
+func Divergence(steps, ref []Step) int {
+	for _, s := range steps {
+		if s.Op == "" {
+			continue
+		}
+		found := false
+		for _, r := range ref {
+			if s.value.Equal(r.value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return s.Index
+		}
+	}
+	return -1
+}
@@ -0,0 +1,95 @@
+package setexpr
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// VennNames — имена кругов диаграммы в порядке отрисовки
+var VennNames = []string{"A", "B", "C"}
+
+type vennCircle struct {
+	cx, cy, r float64
+	lx, ly    float64 // позиция подписи
+}
+
+// раскладка кругов для 1–3 множеств внутри прямоугольника 300×220
+var vennLayouts = map[int][]vennCircle{
+	1: {{150, 115, 70, 150, 35}},
+	2: {{120, 115, 65, 85, 40}, {180, 115, 65, 215, 40}},
+	3: {{120, 92, 58, 72, 30}, {180, 92, 58, 228, 30}, {150, 142, 58, 150, 214}},
+}
+
+const (
+	vennWidth  = 300
+	vennHeight = 224
+)
+
+// VennSVG рисует диаграмму Эйлера–Венна для n множеств (A, B, C)
+// и закрашивает области, входящие в выражение
+func VennSVG(e Expr, n int) (string, error) {
+	layout, ok := vennLayouts[n]
+	if !ok {
+		return "", fmt.Errorf("поддерживается от 1 до %d множеств", len(VennNames))
+	}
+	names := VennNames[:n]
+	allowed := map[string]bool{}
+	for _, name := range names {
+		allowed[name] = true
+	}
+	for _, v := range Vars(e) {
+		if !allowed[v] {
+			return "", fmt.Errorf("множество %s не помещается на диаграмму из %d кругов", v, n)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`,
+		vennWidth, vennHeight, vennWidth, vennHeight)
+	fmt.Fprintf(&b, `<title>%s</title>`, html.EscapeString(e.String()))
+
+	// clipPath «внутри круга» и mask «вне круга» для каждого множества
+	b.WriteString(`<defs>`)
+	for i, c := range layout {
+		fmt.Fprintf(&b, `<clipPath id="in%s"><circle cx="%g" cy="%g" r="%g"/></clipPath>`,
+			names[i], c.cx, c.cy, c.r)
+		fmt.Fprintf(&b, `<mask id="out%s"><rect width="%d" height="%d" fill="white"/><circle cx="%g" cy="%g" r="%g" fill="black"/></mask>`,
+			names[i], vennWidth, vennHeight, c.cx, c.cy, c.r)
+	}
+	b.WriteString(`</defs>`)
+
+	fmt.Fprintf(&b, `<rect x="1" y="1" width="%d" height="%d" fill="white" stroke="#333"/>`, vennWidth-2, vennHeight-2)
+
+	// Каждая закрашенная область — прямоугольник, обрезанный кругами,
+	// в которые она входит, и замаскированный кругами, в которые не входит
+	for _, region := range Regions(names) {
+		in, err := Member(e, region)
+		if err != nil {
+			return "", err
+		}
+		if !in {
+			continue
+		}
+		closing := 0
+		for _, name := range names {
+			if region[name] {
+				fmt.Fprintf(&b, `<g clip-path="url(#in%s)">`, name)
+			} else {
+				fmt.Fprintf(&b, `<g mask="url(#out%s)">`, name)
+			}
+			closing++
+		}
+		fmt.Fprintf(&b, `<rect x="1" y="1" width="%d" height="%d" fill="#7aa7e0"/>`, vennWidth-2, vennHeight-2)
+		b.WriteString(strings.Repeat(`</g>`, closing))
+	}
+
+	for i, c := range layout {
+		fmt.Fprintf(&b, `<circle cx="%g" cy="%g" r="%g" fill="none" stroke="#333" stroke-width="1.5"/>`, c.cx, c.cy, c.r)
+		fmt.Fprintf(&b, `<text x="%g" y="%g" font-family="sans-serif" font-size="16" text-anchor="middle">%s</text>`,
+			c.lx, c.ly, names[i])
+	}
+	fmt.Fprintf(&b, `<text x="12" y="22" font-family="sans-serif" font-size="16">U</text>`)
+	b.WriteString(`</svg>`)
+	return b.String(), nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"registration_form/setexpr"
+)
+
+const (
+	// questionTypeSet — вопрос, ответ на который — множество.
+	// Студент пишет перечисление ({1,2,3}) или выражение (A ∪ B),
+	// проверка идёт по равенству множеств, а не по совпадению строк.
+	questionTypeSet = "set"
+
+	// questionTypeIdentity — вопрос-тождество: «перепишите (A∪B)∪C
+	// в равносильном виде». Ответ верен, если выражение равно эталону
+	// при любых A, B, C; иначе студент получает область-контрпример.
+	questionTypeIdentity = "identity"
+)
+
+// SetDefinitions — множества вопроса: имя → перечисление,
+// например {"A": "{1,2,3}", "B": "{3,4}", "U": "{1..10}"}.
+// U задаёт универсум для дополнения. Хранится в questions.set_definitions (JSONB).
+type SetDefinitions map[string]string
+
+func (d SetDefinitions) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(d)
+	// строкой, а не []byte — иначе pq передаст значение как bytea
+	return string(b), err
+}
+
+func (d *SetDefinitions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, d)
+	case string:
+		return json.Unmarshal([]byte(v), d)
+	}
+	return fmt.Errorf("SetDefinitions: unsupported type %T", src)
+}
+
+// env разбирает определения в окружение для вычисления выражений
+func (d SetDefinitions) env() (setexpr.Env, error) {
+	env := setexpr.Env{Sets: map[string]setexpr.Set{}}
+	for name, src := range d {
+		s, err := setexpr.ParseSet(src)
+		if err != nil {
+			return env, fmt.Errorf("множество %s: %w", name, err)
+		}
+		if name == "U" {
+			env.Universe = s
+		} else {
+			env.Sets[name] = s
+		}
+	}
+	if env.Universe != nil {
+		for name, s := range env.Sets {
+			if s.Difference(env.Universe).Len() > 0 {
+				return env, fmt.Errorf("множество %s не входит в универсум U", name)
+			}
+		}
+	}
+	return env, nil
+}
+
+// validateSetQuestion проверяет, что определения разбираются,
+// а эталонный ответ вычисляется на них
+func validateSetQuestion(defs SetDefinitions, correct string) error {
+	if len(defs) == 0 {
+		return errors.New("для вопроса типа set нужны set_definitions")
+	}
+	env, err := defs.env()
+	if err != nil {
+		return err
+	}
+	if _, err := setexpr.Eval(correct, env); err != nil {
+		return fmt.Errorf("правильный ответ: %w", err)
+	}
+	return nil
+}
+
+// validateIdentityQuestion проверяет эталон тождества: только имена
+// множеств, не больше setexpr.MaxVars различных
+func validateIdentityQuestion(correct string) error {
+	e, err := setexpr.Parse(correct)
+	if err != nil {
+		return fmt.Errorf("правильный ответ: %w", err)
+	}
+	if _, _, err := setexpr.Equivalent(e, e); err != nil {
+		return fmt.Errorf("правильный ответ: %w", err)
+	}
+	return nil
+}
+
+// validateAnswerKey проверяет эталон для типов вопросов, где он
+// должен разбираться как выражение; для остальных типов — ничего не делает
+func validateAnswerKey(qType string, defs SetDefinitions, tmpl SetTemplate, correct string) error {
+	switch qType {
+	case questionTypeSet:
+		if tmpl != nil {
+			return validateSetTemplateQuestion(tmpl, correct)
+		}
+		return validateSetQuestion(defs, correct)
+	case questionTypeIdentity:
+		return validateIdentityQuestion(correct)
+	}
+	return nil
+}
+
+// gradeSetAnswer сравнивает ответ студента с эталоном как множества.
+// Ошибка возвращается только при некорректном вопросе; ответ,
+// который не удалось разобрать, просто считается неверным.
+func gradeSetAnswer(defs SetDefinitions, correct, answer string) (gradeResult, error) {
+	env, err := defs.env()
+	if err != nil {
+		return gradeResult{}, err
+	}
+	want, err := setexpr.Eval(correct, env)
+	if err != nil {
+		return gradeResult{}, err
+	}
+	got, err := setexpr.Eval(answer, env)
+	if err != nil {
+		return gradeResult{Feedback: err.Error()}, nil
+	}
+	return gradeResult{IsCorrect: got.Equal(want), AnswerSet: got.String()}, nil
+}
+
+// correctSet вычисляет эталонное множество для показа в ключе ответов
+func correctSet(defs SetDefinitions, correct string) string {
+	env, err := defs.env()
+	if err != nil {
+		return ""
+	}
+	s, err := setexpr.Eval(correct, env)
+	if err != nil {
+		return ""
+	}
+	return s.String()
+}
+
+// gradeIdentityAnswer проверяет равносильность выражений для всех множеств
+// и при расхождении объясняет, в какой области диаграммы оно найдено
+func gradeIdentityAnswer(correct, answer string) (gradeResult, error) {
+	want, err := setexpr.Parse(correct)
+	if err != nil {
+		return gradeResult{}, err
+	}
+	got, err := setexpr.Parse(answer)
+	if err != nil {
+		return gradeResult{Feedback: err.Error()}, nil
+	}
+	ok, ce, err := setexpr.Equivalent(got, want)
+	if err != nil {
+		return gradeResult{Feedback: err.Error()}, nil
+	}
+	if ok {
+		return gradeResult{IsCorrect: true}, nil
+	}
+	if ce.InLeft {
+		return gradeResult{Feedback: fmt.Sprintf(
+			"Выражения не равносильны: элементы области %s входят в ваше выражение, но не входят в исходное",
+			ce.Region,
+		)}, nil
+	}
+	return gradeResult{Feedback: fmt.Sprintf(
+		"Выражения не равносильны: элементы области %s входят в исходное выражение, но не входят в ваше",
+		ce.Region,
+	)}, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"registration_form/setexpr"
+)
+
+// setTraceRequest — запрос пошагового вычисления.
+// Множества задаются явно (sets) или берутся из вопроса типа set
+// (question_id; для шаблонных вопросов — из попытки attempt_id).
+type setTraceRequest struct {
+	Expr       string         `json:"expr"`
+	Sets       SetDefinitions `json:"sets"`
+	QuestionID int            `json:"question_id"`
+	AttemptID  int            `json:"attempt_id"`
+}
+
+type setTraceResponse struct {
+	Steps  []setexpr.Step `json:"steps"`
+	Result string         `json:"result"`
+	// Заполняются для вопроса, если пользователю виден ключ ответов
+	Reference  []setexpr.Step `json:"reference,omitempty"`
+	IsCorrect  *bool          `json:"is_correct,omitempty"`
+	Divergence *int           `json:"divergence,omitempty"` // номер шага, где решение разошлось с эталоном
+}
+
+// POST /api/sets/trace
+// Вычисляет выражение по шагам: каждое подвыражение и его значение.
+// Для вопроса из теста дополнительно сравнивает ход решения с эталоном —
+// так на странице результатов видно, на каком шаге студент ошибся.
+func SetTraceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Не авторизован", http.StatusUnauthorized)
+		return
+	}
+
+	var req setTraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if req.Expr == "" {
+		http.Error(w, "Поле expr обязательно", http.StatusBadRequest)
+		return
+	}
+	e, err := setexpr.Parse(req.Expr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defs := req.Sets
+	var reference setexpr.Expr
+	if req.QuestionID > 0 {
+		userID, err := currentUserID(claims)
+		if err != nil {
+			http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+			return
+		}
+		var (
+			testID  int
+			qType   string
+			correct sql.NullString
+			tmpl    SetTemplate
+		)
+		err = db.QueryRow(`
+            SELECT test_id, question_type, correct_answer_text, set_definitions, set_template
+              FROM questions WHERE id = $1
+        `, req.QuestionID).Scan(&testID, &qType, &correct, &defs, &tmpl)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Вопрос не найден", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// множества чужого курса не раскрываем: отвечаем так же, как на несуществующий вопрос
+		allowed, err := canAccessTest(db, claims.Role, userID, testID)
+		if err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			http.Error(w, "Вопрос не найден", http.StatusNotFound)
+			return
+		}
+		if qType != questionTypeSet {
+			http.Error(w, "Пошаговое вычисление доступно только для вопросов типа set", http.StatusBadRequest)
+			return
+		}
+		if tmpl != nil {
+			_, seed, ok, err := testAttempt(db, userID, testID, req.AttemptID)
+			if err != nil {
+				http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.Error(w, "Попытка не найдена", http.StatusNotFound)
+				return
+			}
+			if defs, err = tmpl.instantiate(seed, req.QuestionID); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		showKey, err := canSeeAnswerKey(db, claims.Role, userID, testID)
+		if err != nil {
+			http.Error(w, "DB error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if showKey && correct.Valid {
+			if reference, err = setexpr.Parse(correct.String); err != nil {
+				http.Error(w, "Некорректный эталон: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	env, err := defs.env()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	steps, err := setexpr.Trace(e, env)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := setTraceResponse{Steps: steps, Result: steps[len(steps)-1].Set}
+
+	if reference != nil {
+		ref, err := setexpr.Trace(reference, env)
+		if err != nil {
+			http.Error(w, "Некорректный эталон: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ok := ref[len(ref)-1].Set == resp.Result
+		resp.Reference = ref
+		resp.IsCorrect = &ok
+		if !ok {
+			if d := setexpr.Divergence(steps, ref); d >= 0 {
+				resp.Divergence = &d
+			}
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
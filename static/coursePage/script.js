@@ -135,7 +135,6 @@ async function loadCoursePage() {
 }
 
 let currentAttempt = null // { attemptId, attemptNumber, startedAt, answers:{ [q]:true/false } }
-const MAX_ATTEMPTS = 2
 
 async function loadTheory(courseId) {
 	const container = document.getElementById('theory-list')
@@ -208,11 +207,12 @@ async function loadTests(courseId) {
 		}
 
 		for (const test of tests) {
-			// 1) Сколько попыток сделано
-			let done = await getAttemptsDone(test.id)
+			// 1) Сколько попыток сделано и сколько осталось (лимит задаёт преподаватель)
+			const status = await getAttemptStatus(test.id)
+			const done = status.attemptsDone
 			// 2) Последняя завершённая попытка (или null)
 			const latest = await fetchLatestAttempt(test.id)
-			const remaining = MAX_ATTEMPTS - (latest?.attemptNumber || 0)
+			const remaining = status.attemptsLeft ?? Infinity
 
 			// 3) Рендер карточки
 			const card = document.createElement('div')
@@ -275,31 +275,47 @@ async function loadTests(courseId) {
 
 async function onClickStart(testId) {
 	// получаем сколько осталось
-	const latest = await fetchLatestAttempt(testId)
-	const remaining = MAX_ATTEMPTS - (latest?.attemptNumber || 0)
+	const status = await getAttemptStatus(testId)
+	const remaining = status.attemptsLeft
 
 	const titleEl = document.getElementById('startAttemptTitle')
 	const btnStart = document.getElementById('btnStartAttempt')
 
-	if (remaining <= 0) {
+	if (remaining === 0) {
 		// исчерпаны попытки
-		titleEl.textContent = `Вы истратили обе попытки`
+		titleEl.textContent = `Вы истратили все попытки`
+		btnStart.disabled = true
+		btnStart.classList.add('muted')
+	} else if (status.nextAttemptAt) {
+		// действует пауза между попытками
+		titleEl.textContent = `Следующая попытка будет доступна ${new Date(
+			status.nextAttemptAt
+		).toLocaleString()}`
 		btnStart.disabled = true
 		btnStart.classList.add('muted')
 	} else {
 		// остались попытки
-		titleEl.textContent = `У вас есть ${remaining} попытк${
-			remaining === 1 ? 'а' : 'и'
-		}`
+		titleEl.textContent =
+			remaining == null
+				? 'Количество попыток не ограничено'
+				: `Осталось попыток: ${remaining}`
 		btnStart.disabled = false
 		btnStart.classList.remove('muted')
 
 		btnStart.onclick = async () => {
 			closeModal('startAttemptModal')
-			const { attemptId, attemptNumber } = await createAttempt(testId)
+			let attempt
+			try {
+				attempt = await createAttempt(testId)
+			} catch (err) {
+				alert(err.message)
+				return
+			}
+			const { attemptId, attemptNumber, deadlineAt } = attempt
 			currentAttempt = {
 				attemptId,
 				attemptNumber,
+				deadlineAt,
 				startedAt: Date.now(),
 				answers: {},
 				courseId: getCourseId(),
@@ -321,12 +337,13 @@ async function onClickStart(testId) {
 }
 
 // ----- API: Работа с попытками -----
-async function getAttemptsDone(testId) {
+// { attemptsDone, maxAttempts, attemptsLeft (null — без ограничения), nextAttemptAt? }
+async function getAttemptStatus(testId) {
 	const res = await fetch(`/api/tests/${testId}/attempts/count`, {
 		credentials: 'include', // ← ключевой момент
 	})
 	if (!res.ok) throw new Error(`Ошибка ${res.status}`)
-	return (await res.json()).attemptsDone
+	return await res.json()
 }
 
 async function createAttempt(testId) {
@@ -334,7 +351,8 @@ async function createAttempt(testId) {
 		method: 'POST',
 		credentials: 'include',
 	})
-	if (!res.ok) throw new Error(`Не удалось создать попытку: ${res.status}`)
+	// сервер объясняет отказ: лимит попыток или пауза между ними
+	if (!res.ok) throw new Error(await res.text())
 	return await res.json()
 }
 
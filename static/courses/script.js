@@ -141,6 +141,7 @@ async function loadCourses() {
 		<h2>${course.title}</h2>
 		<p>${course.description}</p>
 		<div class="info">Тестов: ${course.test_count}</div>
+		<div class="info">Теория изучена: ${course.completion_percent || 0}%</div>
 		<button onclick="navigate('/static/coursePage/index.html?course=${course.id}')">
 		  Открыть
 		</button>
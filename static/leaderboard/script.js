@@ -48,6 +48,69 @@ function updateToggleIcon(theme) {
 	btn.appendChild(icon)
 }
 
+/* -----------------------
+   3. Рейтинг
+------------------------ */
+async function loadLeaderboard() {
+	const period = document.getElementById('leaderboard-window').value
+	const body = document.getElementById('leaderboard-body')
+	const meEl = document.getElementById('leaderboard-me')
+	try {
+		const res = await fetch(`/api/leaderboard?scope=global&window=${period}`, {
+			credentials: 'same-origin',
+		})
+		if (!res.ok) throw new Error(await res.text())
+		const data = await res.json()
+
+		body.innerHTML = ''
+		if (!data.entries.length) {
+			const tr = document.createElement('tr')
+			const td = document.createElement('td')
+			td.colSpan = 4
+			td.textContent = 'Пока нет результатов'
+			tr.appendChild(td)
+			body.appendChild(tr)
+		}
+		data.entries.forEach(e => {
+			const tr = document.createElement('tr')
+			if (data.me && data.me.user_id === e.user_id) tr.classList.add('is-me')
+			;[e.rank, e.full_name, e.tests, e.score].forEach(v => {
+				const td = document.createElement('td')
+				td.textContent = v
+				tr.appendChild(td)
+			})
+			body.appendChild(tr)
+		})
+
+		meEl.textContent = data.me
+			? `Ваше место: ${data.me.rank}, баллов: ${data.me.score}`
+			: ''
+	} catch (err) {
+		console.error('Ошибка загрузки рейтинга:', err)
+	}
+}
+
+async function loadPrivacy() {
+	const box = document.getElementById('leaderboard-optout')
+	try {
+		const res = await fetch('/api/me/privacy', { credentials: 'same-origin' })
+		if (!res.ok) return
+		const data = await res.json()
+		box.checked = data.leaderboard_opt_out
+	} catch (err) {
+		console.error('Ошибка загрузки настроек:', err)
+	}
+	box.addEventListener('change', async () => {
+		await fetch('/api/me/privacy', {
+			method: 'PUT',
+			credentials: 'same-origin',
+			headers: { 'Content-Type': 'application/json' },
+			body: JSON.stringify({ leaderboard_opt_out: box.checked }),
+		})
+		loadLeaderboard()
+	})
+}
+
 document.addEventListener('DOMContentLoaded', () => {
 	// Подсветка активного пункта меню
 	const path = window.location.pathname
@@ -90,5 +153,9 @@ document.addEventListener('DOMContentLoaded', () => {
 		}
 	})
 
-	// TODO: инициализация и запуск анимации в #animation-container
+	document
+		.getElementById('leaderboard-window')
+		.addEventListener('change', loadLeaderboard)
+	loadLeaderboard()
+	loadPrivacy()
 })
@@ -45,6 +45,53 @@ async function loadUserIcon() {
    3. Загрузка данных профиля
    + показ ссылки "Панель админа"
 ------------------------ */
+// Непрочитанные комментарии преподавателей к попыткам
+async function loadFeedback() {
+	const section = document.getElementById('feedback-section')
+	if (!section) return
+	try {
+		const res = await fetch('/api/me/feedback?unread=1', {
+			credentials: 'same-origin',
+		})
+		if (!res.ok) throw new Error(res.status)
+		const data = await res.json()
+		if (!data.unread) {
+			section.hidden = true
+			return
+		}
+
+		document.getElementById('feedback-count').textContent = data.unread
+		const list = document.getElementById('feedback-list')
+		list.innerHTML = ''
+		data.comments.forEach(c => {
+			const li = document.createElement('li')
+			li.className = 'feedback-item'
+
+			const head = document.createElement('div')
+			head.className = 'feedback-head'
+			head.textContent = `${c.test_title} · ${c.author_name} · ${new Date(
+				c.created_at
+			).toLocaleString()}`
+			li.appendChild(head)
+
+			if (c.question_text) {
+				const q = document.createElement('div')
+				q.className = 'feedback-question'
+				q.textContent = c.question_text
+				li.appendChild(q)
+			}
+
+			const body = document.createElement('p')
+			body.textContent = c.body
+			li.appendChild(body)
+			list.appendChild(li)
+		})
+		section.hidden = false
+	} catch (err) {
+		console.error('Ошибка загрузки отзывов:', err)
+	}
+}
+
 async function loadProfile() {
 	try {
 		const res = await fetch('/api/profile', { credentials: 'same-origin' })
@@ -195,6 +242,7 @@ document.addEventListener('DOMContentLoaded', () => {
 
 	// D) Загрузка профиля
 	loadProfile()
+	loadFeedback()
 
 	// accordion для личных данных
 	const toggleBtn = document.getElementById('profile-toggle')
@@ -295,6 +343,21 @@ document.addEventListener('DOMContentLoaded', () => {
 		})
 	}
 
+	// F2) Отметить отзывы прочитанными
+	const readAllBtn = document.getElementById('feedback-read-all')
+	if (readAllBtn) {
+		readAllBtn.addEventListener('click', () => {
+			fetch('/api/me/feedback/read', {
+				method: 'POST',
+				credentials: 'same-origin',
+				headers: { 'Content-Type': 'application/json' },
+				body: JSON.stringify({ ids: [] }),
+			})
+				.then(() => loadFeedback())
+				.catch(err => console.error('Mark feedback read error:', err))
+		})
+	}
+
 	// G) Кнопка выхода
 	const logoutBtn = document.getElementById('logout-btn')
 	if (logoutBtn) {
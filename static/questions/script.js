@@ -58,48 +58,6 @@ async function loadUserIcon() {
 	}
 }
 
-function levenshtein(a, b) {
-	const an = a.length
-	const bn = b.length
-	if (an === 0) return bn
-	if (bn === 0) return an
-
-	const matrix = []
-
-	for (let i = 0; i <= bn; i++) {
-		matrix[i] = [i]
-	}
-	for (let j = 0; j <= an; j++) {
-		matrix[0][j] = j
-	}
-
-	for (let i = 1; i <= bn; i++) {
-		for (let j = 1; j <= an; j++) {
-			if (b.charAt(i - 1) === a.charAt(j - 1)) {
-				matrix[i][j] = matrix[i - 1][j - 1]
-			} else {
-				matrix[i][j] = Math.min(
-					matrix[i - 1][j - 1] + 1, // замена
-					matrix[i][j - 1] + 1, // вставка
-					matrix[i - 1][j] + 1 // удаление
-				)
-			}
-		}
-	}
-
-	return matrix[bn][an]
-}
-
-function compareTextAnswers(userInput, correct, threshold = 80) {
-	const u = userInput.trim().toLowerCase()
-	const c = correct.trim().toLowerCase()
-	if (!c) return false
-	const distance = levenshtein(u, c)
-	const maxLen = Math.max(u.length, c.length)
-	const similarity = (1 - distance / maxLen) * 100
-	return similarity >= threshold
-}
-
 // Показать popup с результатом
 function showPopup(score, total) {
 	const overlay = document.getElementById('popupOverlay')
@@ -120,22 +78,68 @@ async function createAttempt(testId) {
 		method: 'POST',
 		credentials: 'include',
 	})
-	if (!res.ok) throw new Error(`Не удалось создать попытку: ${res.status}`)
+	// сервер объясняет отказ: лимит попыток или пауза между ними
+	if (!res.ok) throw new Error(await res.text())
 	return await res.json()
 }
 
-// Отправка одного ответа на бэкенд
-async function submitAnswer(attemptId, questionId, isCorrect) {
-	await fetch('/api/student/answer', {
+// Сколько попыток осталось и когда можно начать следующую
+async function fetchAttemptStatus(testId) {
+	const res = await fetch(`/api/tests/${testId}/attempts/count`, {
+		credentials: 'same-origin',
+	})
+	if (!res.ok) throw new Error(`Ошибка ${res.status}`)
+	return await res.json()
+}
+
+// Отправка одного ответа на бэкенд — проверка выполняется на сервере
+async function submitAnswer(attemptId, questionId, answer) {
+	const res = await fetch('/api/student/answer', {
 		method: 'POST',
 		credentials: 'same-origin',
 		headers: { 'Content-Type': 'application/json' },
 		body: JSON.stringify({
 			attempt_id: attemptId,
 			question_id: questionId,
-			is_correct: isCorrect,
+			...answer,
 		}),
 	})
+	if (!res.ok) throw new Error(`Не удалось отправить ответ: ${res.status}`)
+	return await res.json()
+}
+
+// Пошаговое вычисление ответа на вопрос типа set
+async function traceAnswer(attemptId, questionId, expr) {
+	const res = await fetch('/api/sets/trace', {
+		method: 'POST',
+		credentials: 'same-origin',
+		headers: { 'Content-Type': 'application/json' },
+		body: JSON.stringify({
+			attempt_id: attemptId,
+			question_id: questionId,
+			expr,
+		}),
+	})
+	if (!res.ok) return null
+	return await res.json()
+}
+
+// Показывает шаги вычисления; шаг, где решение разошлось с эталоном, выделяется
+function renderTrace(wrapper, trace) {
+	const list = document.createElement('ol')
+	list.className = 'answer-trace'
+	trace.steps
+		.filter(step => step.op)
+		.forEach(step => {
+			const li = document.createElement('li')
+			li.textContent = `${step.expr} = ${step.set}`
+			if (step.index === trace.divergence) {
+				li.classList.add('answer-trace-divergence')
+				li.title = 'Здесь решение расходится с правильным'
+			}
+			list.appendChild(li)
+		})
+	if (list.children.length) wrapper.appendChild(list)
 }
 
 // Основная логика
@@ -167,9 +171,15 @@ document.addEventListener('DOMContentLoaded', async () => {
 	}
 
 	// ===== Загружаем вопросы =====
+	// Вопросы запрашиваются для текущей попытки: у шаблонных вопросов
+	// множества свои в каждой попытке
 	let questions
 	try {
-		const res = await fetch(`/api/tests/${testId}/questions`, {
+		loadState()
+		const query = currentAttempt?.attemptId
+			? `?attempt_id=${currentAttempt.attemptId}`
+			: ''
+		const res = await fetch(`/api/tests/${testId}/questions${query}`, {
 			credentials: 'same-origin',
 		})
 		if (!res.ok) throw new Error(res.status)
@@ -180,19 +190,11 @@ document.addEventListener('DOMContentLoaded', async () => {
 		return
 	}
 
-	// ----- Константы и API-обёртки -----
-	const MAX_ATTEMPTS = 2
-
-	async function finishAttempt(attemptId, score, correct, wrong) {
+	// ----- API-обёртки -----
+	async function finishAttempt(attemptId) {
 		const res = await fetch(`/api/attempts/${attemptId}/finish`, {
 			method: 'PATCH',
 			credentials: 'same-origin',
-			headers: { 'Content-Type': 'application/json' },
-			body: JSON.stringify({
-				score,
-				correct_answers: correct,
-				wrong_answers: wrong,
-			}),
 		})
 		if (!res.ok) throw new Error(`Не удалось завершить попытку: ${res.status}`)
 		return await res.json()
@@ -225,6 +227,7 @@ document.addEventListener('DOMContentLoaded', async () => {
 		questions.forEach((q, idx) => {
 			const wrapper = document.createElement('div')
 			wrapper.className = 'question'
+			wrapper.dataset.questionId = q.id
 
 			// Заголовок и метка сложности
 			const header = document.createElement('div')
@@ -248,9 +251,25 @@ document.addEventListener('DOMContentLoaded', async () => {
 			// Устанавливаем текст метки на русском
 			diffLabel.textContent = difficultyMap[q.difficulty] || q.difficulty
 
-			header.append(h, diffLabel)
+			// Вес вопроса в баллах
+			const pointsLabel = document.createElement('span')
+			pointsLabel.className = 'points-label'
+			pointsLabel.textContent = `${q.points ?? 1} б.`
+
+			header.append(h, pointsLabel, diffLabel)
 			wrapper.appendChild(header)
 
+			// Для вопросов-множеств показываем заданные множества
+			if (q.set_definitions) {
+				const defs = document.createElement('p')
+				defs.className = 'set-definitions'
+				defs.textContent = Object.keys(q.set_definitions)
+					.sort()
+					.map(name => `${name} = ${q.set_definitions[name]}`)
+					.join(';  ')
+				wrapper.appendChild(defs)
+			}
+
 			// Вопрос закрытого/открытого типа
 			if (q.question_type === 'closed') {
 				q.options.forEach(opt => {
@@ -293,6 +312,11 @@ document.addEventListener('DOMContentLoaded', async () => {
 				const ta = document.createElement('textarea')
 				ta.name = `q_${q.id}`
 				ta.classList.add('open-question-input')
+				if (q.question_type === 'set') {
+					ta.placeholder = 'Например: {1, 2, 3} или A ∪ (B ∩ C)'
+				} else if (q.question_type === 'identity') {
+					ta.placeholder = 'Равносильное выражение, например: A ∪ (B ∪ C)'
+				}
 
 				// Восстановим предыдущий ввод
 				if (currentAttempt?.answers?.[q.id]) {
@@ -312,53 +336,90 @@ document.addEventListener('DOMContentLoaded', async () => {
 			form.appendChild(wrapper)
 		})
 
-		document.getElementById('check').addEventListener('click', async () => {
-			let score = 0,
-				correct = 0,
-				wrong = 0
+		// Таймер для тестов с ограничением времени: по истечении
+		// ответы отправляются автоматически (сервер после дедлайна их не примет)
+		if (currentAttempt?.deadlineAt) {
+			const deadline = new Date(currentAttempt.deadlineAt).getTime()
+			const timer = document.createElement('p')
+			timer.className = 'attempt-timer'
+			form.before(timer)
+			let timerId
+			const tick = () => {
+				const left = Math.max(0, Math.floor((deadline - Date.now()) / 1000))
+				const mm = String(Math.floor(left / 60)).padStart(2, '0')
+				const ss = String(left % 60).padStart(2, '0')
+				timer.textContent = `Осталось времени: ${mm}:${ss}`
+				if (left === 0) {
+					clearInterval(timerId)
+					document.getElementById('check').click()
+				}
+			}
+			timerId = setInterval(tick, 1000)
+			tick()
+		}
 
+		document.getElementById('check').addEventListener('click', async () => {
+			const wrongSetAnswers = []
 			for (const q of questions) {
-				let isCorrect
+				const saved = currentAttempt.answers[q.id]
+				let answer
 				if (q.question_type === 'closed') {
-					const sel = Array.isArray(currentAttempt.answers[q.id])
-						? currentAttempt.answers[q.id]
-						: [currentAttempt.answers[q.id]]
-					const sol = q.options.filter(o => o.is_correct).map(o => String(o.id))
-					isCorrect =
-						sel.length === sol.length && sel.every(v => sol.includes(v))
+					const sel = Array.isArray(saved) ? saved : saved ? [saved] : []
+					// отправляем номера вариантов в показанном порядке —
+					// сервер сам сопоставит их с вариантами вопроса
+					answer = {
+						option_positions: sel
+							.map(id => q.options.findIndex(o => String(o.id) === String(id)))
+							.filter(pos => pos >= 0),
+					}
 				} else {
-					isCorrect = compareTextAnswers(
-						currentAttempt.answers[q.id] || '',
-						q.correct_answer_text,
-						80
-					)
+					answer = { answer_text: saved || '' }
 				}
 
-				// здесь отправляем каждый ответ
-				await submitAnswer(currentAttempt.attemptId, q.id, isCorrect)
+				// здесь отправляем каждый ответ, сервер сам его проверяет
+				const result = await submitAnswer(currentAttempt.attemptId, q.id, answer)
 
-				// считаем результат
-				if (isCorrect) {
-					score++
-					correct++
-				} else {
-					wrong++
+				// пояснение сервера (например, контрпример для тождества)
+				if (result.feedback) {
+					const wrapper = form.querySelector(`[data-question-id="${q.id}"]`)
+					const fb = document.createElement('p')
+					fb.className = 'answer-feedback'
+					fb.textContent = result.feedback
+					wrapper?.appendChild(fb)
+				}
+				if (q.question_type === 'set' && !result.is_correct && saved) {
+					wrongSetAnswers.push({ q, saved })
 				}
 			}
 
-			// завершаем попытку один раз
-			await finishAttempt(currentAttempt.attemptId, score, correct, wrong)
+			// завершаем попытку один раз — итог считает сервер
+			const { score } = await finishAttempt(currentAttempt.attemptId)
+
+			// после завершения показываем, на каком шаге ошибка в выражении
+			for (const { q, saved } of wrongSetAnswers) {
+				const trace = await traceAnswer(currentAttempt.attemptId, q.id, saved)
+				const wrapper = form.querySelector(`[data-question-id="${q.id}"]`)
+				if (trace && wrapper) renderTrace(wrapper, trace)
+			}
 
 			// показываем модалку с результатом
 			document.getElementById(
 				'finishAttemptTitle'
 			).textContent = `Вы набрали ${score} баллов`
-			document.getElementById('finishAttemptMsg').textContent =
-				currentAttempt.attemptNumber === 1
-					? 'У вас осталась 1 попытка'
-					: 'У вас не осталось попыток'
+			const status = await fetchAttemptStatus(testId)
+			const left = status.attemptsLeft
+			let msg =
+				left == null
+					? 'Количество попыток не ограничено'
+					: left === 0
+					? 'У вас не осталось попыток'
+					: `Осталось попыток: ${left}`
+			if (left !== 0 && status.nextAttemptAt) {
+				msg += `. Следующая — ${new Date(status.nextAttemptAt).toLocaleString()}`
+			}
+			document.getElementById('finishAttemptMsg').textContent = msg
 			document.getElementById('btnRetryAttempt').disabled =
-				currentAttempt.attemptNumber >= MAX_ATTEMPTS
+				left === 0 || Boolean(status.nextAttemptAt)
 
 			showModal('finishAttemptModal')
 		})
@@ -372,11 +433,19 @@ document.addEventListener('DOMContentLoaded', async () => {
 		}
 
 		document.getElementById('btnRetryAttempt').onclick = async () => {
+			let attempt
+			try {
+				attempt = await createAttempt(testId)
+			} catch (err) {
+				alert(err.message)
+				return
+			}
 			clearState()
-			const { attemptId, attemptNumber } = await createAttempt(testId)
+			const { attemptId, attemptNumber, deadlineAt } = attempt
 			currentAttempt = {
 				attemptId,
 				attemptNumber,
+				deadlineAt,
 				startedAt: Date.now(),
 				answers: {},
 				testId,
@@ -93,6 +93,62 @@ async function initTeacherGroupDetail() {
 		})
 	}
 	document.dispatchEvent(new CustomEvent('teacherGroupDetail:loaded'))
+	loadGradebook(groupId)
+}
+
+// Журнал оценок: студенты × тесты, в ячейке — итоговая оценка и число попыток
+async function loadGradebook(groupId) {
+	const base = `/api/teacher/groups/${groupId}/gradebook`
+	document.getElementById('gradebookCsv').href = `${base}?format=csv`
+	document.getElementById('gradebookXlsx').href = `${base}?format=xlsx`
+
+	const head = document.getElementById('gradebookHead')
+	const body = document.getElementById('gradebookBody')
+	let gb
+	try {
+		const res = await fetch(base, { credentials: 'include' })
+		if (!res.ok) throw new Error(await res.text())
+		gb = await res.json()
+	} catch (err) {
+		console.error('[ERROR] gradebook:', err)
+		body.innerHTML = '<tr><td>Не удалось загрузить журнал</td></tr>'
+		return
+	}
+
+	const headRow = document.createElement('tr')
+	;['ФИО', ...gb.tests.map(t => `${t.title} (из ${t.max_score})`), 'Итого'].forEach(
+		text => {
+			const th = document.createElement('th')
+			th.textContent = text
+			headRow.appendChild(th)
+		}
+	)
+	head.innerHTML = ''
+	head.appendChild(headRow)
+
+	body.innerHTML = ''
+	gb.students.forEach(s => {
+		const tr = document.createElement('tr')
+		const name = document.createElement('td')
+		name.textContent = s.full_name
+		tr.appendChild(name)
+		s.cells.forEach(c => {
+			const td = document.createElement('td')
+			if (c.attempts) {
+				td.textContent = `${c.grade} (${c.attempts})`
+				td.title = `Лучший: ${c.best_score}, последняя попытка: ${new Date(
+					c.last_attempt_at
+				).toLocaleString()}`
+			} else {
+				td.textContent = '—'
+			}
+			tr.appendChild(td)
+		})
+		const total = document.createElement('td')
+		total.textContent = s.total
+		tr.appendChild(total)
+		body.appendChild(tr)
+	})
 }
 document.addEventListener('teacherGroupDetail:loaded', initTeacherGroupSearch)
 
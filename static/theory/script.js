@@ -45,6 +45,65 @@ function initTheme() {
 	})
 }
 
+// Интервал heartbeat в секундах: сервер засчитывает не больше минуты за раз
+const HEARTBEAT_INTERVAL = 30
+
+// Время чтения: пока вкладка видна, раз в HEARTBEAT_INTERVAL отправляем прошедшие секунды
+function startHeartbeat(topicId) {
+	let visibleSince = document.hidden ? null : Date.now()
+
+	const flush = () => {
+		if (visibleSince === null) return
+		const seconds = Math.round((Date.now() - visibleSince) / 1000)
+		visibleSince = document.hidden ? null : Date.now()
+		if (seconds <= 0) return
+		fetch(`/api/theory/${topicId}/heartbeat`, {
+			method: 'POST',
+			credentials: 'same-origin',
+			keepalive: true,
+			headers: { 'Content-Type': 'application/json' },
+			body: JSON.stringify({ seconds }),
+		}).catch(err => console.error('Heartbeat error:', err))
+	}
+
+	setInterval(flush, HEARTBEAT_INTERVAL * 1000)
+	document.addEventListener('visibilitychange', () => {
+		if (document.hidden) {
+			flush()
+			visibleSince = null
+		} else {
+			visibleSince = Date.now()
+		}
+	})
+	window.addEventListener('pagehide', flush)
+}
+
+// Кнопка «Отметить как изученное» — повторное нажатие снимает отметку
+function initCompleteButton(topicId, completed) {
+	const btn = document.getElementById('mark-complete')
+	if (!btn) return
+	const render = () => {
+		btn.textContent = completed ? 'Изучено ✓' : 'Отметить как изученное'
+		btn.classList.toggle('completed', completed)
+	}
+	render()
+	btn.hidden = false
+	btn.addEventListener('click', async () => {
+		try {
+			const res = await fetch(`/api/theory/${topicId}/complete`, {
+				method: completed ? 'DELETE' : 'POST',
+				credentials: 'same-origin',
+			})
+			if (!res.ok) throw new Error(await res.text())
+			const state = await res.json()
+			completed = state.completed
+			render()
+		} catch (err) {
+			console.error('Complete error:', err)
+		}
+	})
+}
+
 document.addEventListener('DOMContentLoaded', async () => {
 	initTheme()
 	await loadUserIcon()
@@ -67,6 +126,9 @@ document.addEventListener('DOMContentLoaded', async () => {
 		// Выводим теорию
 		document.getElementById('title').textContent = data.title
 		document.getElementById('content').innerHTML = data.content
+
+		initCompleteButton(id, data.progress && data.progress.completed)
+		startHeartbeat(id)
 	} catch (err) {
 		console.error(err)
 		document.getElementById('content').textContent = 'Ошибка загрузки теории.'
@@ -31,7 +31,7 @@ type Claims struct {
 type Option struct {
 	ID        int       `json:"id"`
 	Text      string    `json:"text"`
-	IsCorrect bool      `json:"is_correct"`
+	IsCorrect *bool     `json:"is_correct,omitempty"` // nil, если ключ скрыт от студента
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -60,6 +60,8 @@ type TheoryWithTests struct {
 	CourseID  int       `json:"course_id"`
 	CreatedAt time.Time `json:"created_at"`
 	Tests     []Test    `json:"tests"`
+	// Progress — прогресс текущего пользователя по этой теме
+	Progress theoryState `json:"progress"`
 }
 
 // UserInfo — модель для вывода в админке
@@ -92,11 +94,18 @@ type CourseInfo struct {
 
 // TestInfo — структура для панели учителя
 type TestInfo struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	CourseID    int       `json:"course_id"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID               int       `json:"id"`
+	Title            string    `json:"title"`
+	Description      string    `json:"description"`
+	CourseID         int       `json:"course_id"`
+	ReviewPolicy     string    `json:"review_policy"`
+	TimeLimit        int       `json:"time_limit"`       // минуты, 0 — без ограничения
+	MaxAttempts      int       `json:"max_attempts"`     // 0 — без ограничения
+	AttemptCooldown  int       `json:"attempt_cooldown"` // минуты между попытками
+	GradingPolicy    string    `json:"grading_policy"`   // best, last или average
+	ShuffleQuestions bool      `json:"shuffle_questions"`
+	ShuffleOptions   bool      `json:"shuffle_options"`
+	CreatedAt        time.Time `json:"created_at"`
 }
 
 type QuestionInfo struct {
@@ -106,6 +115,10 @@ type QuestionInfo struct {
 	QuestionType      string         `json:"question_type"`
 	MultipleChoice    bool           `json:"multiple_choice"`
 	CorrectAnswerText sql.NullString `json:"-"` // временно скрываем
+	SetDefinitions    SetDefinitions `json:"set_definitions,omitempty"`
+	SetTemplate       SetTemplate    `json:"set_template,omitempty"`
+	Points            float64        `json:"points"`
+	ScoringRule       string         `json:"scoring_rule"`
 	Difficulty        string         `json:"difficulty"`
 	CreatedAt         time.Time      `json:"created_at"`
 	Options           []OptionInfo   `json:"options,omitempty"`
@@ -113,7 +126,14 @@ type QuestionInfo struct {
 
 type QuestionInfoOut struct {
 	QuestionInfo
-	CorrectAnswerText string `json:"correct_answer_text,omitempty"`
+	CorrectAnswerText string          `json:"correct_answer_text,omitempty"`
+	CorrectSet        string          `json:"correct_set,omitempty"` // эталон вопроса типа set, вычисленный на его множествах
+	AcceptedAnswers   AcceptedAnswers `json:"accepted_answers,omitempty"`
+	// параметры последней калибровки по модели Раша (см. irt.go); nil — ещё не калибровался
+	IRTDifficulty   *float64   `json:"irt_difficulty"`
+	IRTSE           *float64   `json:"irt_se"`
+	IRTResponses    int        `json:"irt_responses"`
+	IRTCalibratedAt *time.Time `json:"irt_calibrated_at"`
 }
 
 type OptionInfo struct {
@@ -124,14 +144,43 @@ type OptionInfo struct {
 	CreatedAt  time.Time `json:"created_at"`
 }
 
+// StudentQuestionInfo — вопрос в том виде, в каком его видит студент:
+// без correct_answer_text и признаков правильности вариантов
+type StudentQuestionInfo struct {
+	ID             int                 `json:"id"`
+	TestID         int                 `json:"test_id"`
+	QuestionText   string              `json:"question_text"`
+	QuestionType   string              `json:"question_type"`
+	MultipleChoice bool                `json:"multiple_choice"`
+	SetDefinitions SetDefinitions      `json:"set_definitions,omitempty"`
+	Points         float64             `json:"points"`
+	Difficulty     string              `json:"difficulty"`
+	CreatedAt      time.Time           `json:"created_at"`
+	Options        []StudentOptionInfo `json:"options,omitempty"`
+}
+
+type StudentOptionInfo struct {
+	ID         int       `json:"id"`
+	QuestionID int       `json:"question_id"`
+	OptionText string    `json:"option_text"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type teacherQuestionRequest struct {
-	ID                int    `json:"id,omitempty"`
-	TestID            int    `json:"test_id"`
-	QuestionText      string `json:"question_text"`
-	QuestionType      string `json:"question_type"`
-	MultipleChoice    bool   `json:"multiple_choice"`
-	CorrectAnswerText string `json:"correct_answer_text"`
-	Difficulty        string `json:"difficulty"`
+	ID                int            `json:"id,omitempty"`
+	TestID            int            `json:"test_id"`
+	QuestionText      string         `json:"question_text"`
+	QuestionType      string         `json:"question_type"`
+	MultipleChoice    bool           `json:"multiple_choice"`
+	CorrectAnswerText string         `json:"correct_answer_text"`
+	SetDefinitions    SetDefinitions `json:"set_definitions,omitempty"`
+	SetTemplate       SetTemplate    `json:"set_template,omitempty"`
+	Points            *float64       `json:"points"`       // nil — 1 балл при создании, без изменений при обновлении
+	ScoringRule       string         `json:"scoring_rule"` // пусто — all_or_nothing / без изменений
+	// AcceptedAnswers — допустимые ответы открытого вопроса;
+	// отсутствует — без изменений, [] — очистить список
+	AcceptedAnswers AcceptedAnswers `json:"accepted_answers"`
+	Difficulty      string          `json:"difficulty"`
 }
 
 // GroupDetail включает информацию о группе и её студентах
@@ -159,9 +208,12 @@ type studentGroupPayload struct {
 }
 
 type UserQuestionAnswer struct {
-	ID         int       `json:"id"`
-	UserID     int       `json:"user_id"`
-	QuestionID int       `json:"question_id"`
-	IsCorrect  bool      `json:"is_correct"`
-	AnsweredAt time.Time `json:"answered_at"`
+	ID                int       `json:"id"`
+	UserID            int       `json:"user_id"`
+	QuestionID        int       `json:"question_id"`
+	IsCorrect         bool      `json:"is_correct"`
+	SelectedOptionIDs []int64   `json:"selected_option_ids,omitempty"`
+	AnswerText        *string   `json:"answer_text,omitempty"`
+	AnswerSet         *string   `json:"answer_set,omitempty"`
+	AnsweredAt        time.Time `json:"answered_at"`
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"registration_form/setexpr"
+)
+
+// SetTemplate — шаблон множеств для вопроса типа set: вместо фиксированных
+// set_definitions каждая попытка получает свой экземпляр, например
+// {"U": {"from": "{1..10}"}, "A": {"from": "{1..10}", "size": 4}}.
+// Экземпляр воспроизводим: он зависит только от seed попытки и ID вопроса.
+// Хранится в questions.set_template (JSONB).
+type SetTemplate map[string]SetGenerator
+
+// SetGenerator — правило для одного множества шаблона
+type SetGenerator struct {
+	From    string `json:"from"`               // откуда выбирать элементы: {1..10}
+	Size    int    `json:"size,omitempty"`     // точный размер подмножества
+	MinSize int    `json:"min_size,omitempty"` // или случайный размер от min_size
+	MaxSize int    `json:"max_size,omitempty"` // до max_size; без размеров берётся всё from
+}
+
+func (t SetTemplate) Value() (driver.Value, error) {
+	if t == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(t)
+	return string(b), err
+}
+
+func (t *SetTemplate) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	}
+	return fmt.Errorf("SetTemplate: unsupported type %T", src)
+}
+
+// validate проверяет источники и размеры, а также то, что все
+// источники лежат в универсуме U (если он задан). U берётся целиком:
+// если бы он сам был случайным подмножеством, остальные множества
+// экземпляра могли бы выйти за его пределы.
+func (t SetTemplate) validate() error {
+	if len(t) == 0 {
+		return fmt.Errorf("пустой шаблон")
+	}
+	var universe setexpr.Set
+	if g, ok := t["U"]; ok {
+		if g.Size != 0 || g.MinSize != 0 || g.MaxSize != 0 {
+			return fmt.Errorf("шаблон U: размер не задаётся, универсум берётся целиком из from")
+		}
+		u, err := setexpr.ParseSet(g.From)
+		if err != nil {
+			return fmt.Errorf("шаблон U: %w", err)
+		}
+		universe = u
+	}
+	for name, g := range t {
+		from, err := setexpr.ParseSet(g.From)
+		if err != nil {
+			return fmt.Errorf("шаблон %s: %w", name, err)
+		}
+		if g.Size < 0 || g.MinSize < 0 || g.MaxSize < 0 ||
+			(g.MaxSize > 0 && g.MinSize > g.MaxSize) || (g.MinSize > 0 && g.MaxSize == 0) {
+			return fmt.Errorf("шаблон %s: некорректный размер", name)
+		}
+		if g.Size > from.Len() || g.MaxSize > from.Len() {
+			return fmt.Errorf("шаблон %s: размер больше, чем элементов в from", name)
+		}
+		// наименьший размер, который может выпасть в экземпляре
+		minSize := from.Len()
+		switch {
+		case g.Size > 0:
+			minSize = g.Size
+		case g.MaxSize > 0:
+			minSize = g.MinSize
+		}
+		if minSize == 0 {
+			return fmt.Errorf("шаблон %s: в экземпляре может получиться пустое множество", name)
+		}
+		if universe != nil && from.Difference(universe).Len() > 0 {
+			return fmt.Errorf("шаблон %s: from не входит в универсум U", name)
+		}
+	}
+	return nil
+}
+
+// instantiate строит экземпляр множеств для попытки с данным seed
+func (t SetTemplate) instantiate(seed int64, questionID int) (SetDefinitions, error) {
+	rng := rand.New(rand.NewSource(seed ^ int64(questionID)*0x5DEECE66D))
+
+	// порядок обхода фиксирован, иначе экземпляр не будет воспроизводимым
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := SetDefinitions{}
+	for _, name := range names {
+		g := t[name]
+		from, err := setexpr.ParseSet(g.From)
+		if err != nil {
+			return nil, fmt.Errorf("шаблон %s: %w", name, err)
+		}
+		elems := from.Elements()
+		size := len(elems)
+		switch {
+		case g.Size > 0:
+			size = g.Size
+		case g.MaxSize > 0:
+			size = g.MinSize + rng.Intn(g.MaxSize-g.MinSize+1)
+		}
+		if size > len(elems) {
+			size = len(elems)
+		}
+		picked := setexpr.NewSet()
+		for _, i := range rng.Perm(len(elems))[:size] {
+			picked.Add(elems[i])
+		}
+		out[name] = picked.String()
+	}
+	return out, nil
+}
+
+// templateSampleSeeds — на скольких экземплярах проверяется шаблон при сохранении
+const templateSampleSeeds = 64
+
+// validateSetTemplateQuestion проверяет шаблон и то, что эталонный ответ
+// вычисляется на его экземплярах. Размеры и пустые множества validate
+// проверяет для любых seed; экземпляры для seed 1..templateSampleSeeds
+// ловят то, что зависит от конкретного выбора элементов.
+func validateSetTemplateQuestion(tmpl SetTemplate, correct string) error {
+	if err := tmpl.validate(); err != nil {
+		return err
+	}
+	for seed := int64(1); seed <= templateSampleSeeds; seed++ {
+		sample, err := tmpl.instantiate(seed, 0)
+		if err != nil {
+			return err
+		}
+		if err := validateSetQuestion(sample, correct); err != nil {
+			return fmt.Errorf("экземпляр %v: %w", sample, err)
+		}
+	}
+	return nil
+}
+
+// attemptSeed возвращает seed попытки для построения экземпляров шаблонов
+func attemptSeed(q queryer, attemptID int) (int64, error) {
+	var seed int64
+	err := q.QueryRow(`SELECT seed FROM user_test_attempts WHERE id = $1`, attemptID).Scan(&seed)
+	return seed, err
+}
+
+// testAttempt находит попытку, для которой показываются вопросы теста:
+// указанную явно (attemptID > 0) или последнюю незавершённую.
+// ok == false, если такой попытки у пользователя нет.
+func testAttempt(q queryer, userID, testID, attemptID int) (id int, seed int64, ok bool, err error) {
+	if attemptID > 0 {
+		err = q.QueryRow(`
+            SELECT id, seed FROM user_test_attempts
+             WHERE id = $1 AND user_id = $2 AND test_id = $3
+        `, attemptID, userID, testID).Scan(&id, &seed)
+	} else {
+		err = q.QueryRow(`
+            SELECT id, seed FROM user_test_attempts
+             WHERE user_id = $1 AND test_id = $2 AND finished_at IS NULL
+             ORDER BY started_at DESC
+             LIMIT 1
+        `, userID, testID).Scan(&id, &seed)
+	}
+	if err == sql.ErrNoRows {
+		return 0, 0, false, nil
+	}
+	return id, seed, err == nil, err
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxHeartbeatSeconds — больше этого один heartbeat не засчитывает:
+// вкладка могла быть неактивна, а клиент — прислать накопленное время.
+// Кроме того, heartbeat засчитывает не больше времени, прошедшего с
+// предыдущего (last_seen_at), — частые запросы не накручивают время.
+const maxHeartbeatSeconds = 60
+
+// theoryState — прогресс пользователя по одной теме
+type theoryState struct {
+	TheoryID    int        `json:"theory_id"`
+	TimeSpent   int        `json:"time_spent"` // секунды
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// courseCompletion — сколько тем курса пользователь отметил изученными
+type courseCompletion struct {
+	TheoryTotal     int     `json:"theory_total"`
+	TheoryCompleted int     `json:"theory_completed"`
+	Percent         float64 `json:"completion_percent"`
+}
+
+// recordTheoryView отмечает, что текущий пользователь открыл тему.
+// Ошибки только логируются: отметка не должна мешать показу теории.
+func recordTheoryView(r *http.Request, theoryID int) {
+	claims := getClaims(r.Context())
+	if claims == nil {
+		return
+	}
+	userID, err := currentUserID(claims)
+	if err != nil {
+		return
+	}
+	if _, err := db.Exec(`
+        INSERT INTO theory_views (user_id, theory_id, last_seen_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (user_id, theory_id) DO UPDATE SET last_seen_at = NOW()
+    `, userID, theoryID); err != nil {
+		log.Println("recordTheoryView error:", err)
+	}
+}
+
+// loadCourseCompletion возвращает долю изученных тем по каждому курсу
+func loadCourseCompletion(q queryer, userID int) (map[int]courseCompletion, error) {
+	rows, err := q.Query(`
+        SELECT th.course_id, COUNT(*), COUNT(v.completed_at)
+          FROM theory th
+          LEFT JOIN theory_views v ON v.theory_id = th.id AND v.user_id = $1
+         GROUP BY th.course_id
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int]courseCompletion{}
+	for rows.Next() {
+		var (
+			courseID int
+			c        courseCompletion
+		)
+		if err := rows.Scan(&courseID, &c.TheoryTotal, &c.TheoryCompleted); err != nil {
+			return nil, err
+		}
+		if c.TheoryTotal > 0 {
+			c.Percent = float64(c.TheoryCompleted*10000/c.TheoryTotal) / 100
+		}
+		out[courseID] = c
+	}
+	return out, rows.Err()
+}
+
+// loadTheoryStates — прогресс по темам курса: theory_id → состояние
+func loadTheoryStates(q queryer, userID, courseID int) (map[int]theoryState, error) {
+	rows, err := q.Query(`
+        SELECT v.theory_id, v.time_spent, v.completed_at
+          FROM theory_views v
+          JOIN theory th ON th.id = v.theory_id
+         WHERE v.user_id = $1 AND th.course_id = $2
+    `, userID, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int]theoryState{}
+	for rows.Next() {
+		var (
+			s         theoryState
+			completed sql.NullTime
+		)
+		if err := rows.Scan(&s.TheoryID, &s.TimeSpent, &completed); err != nil {
+			return nil, err
+		}
+		if completed.Valid {
+			s.Completed = true
+			s.CompletedAt = &completed.Time
+		}
+		out[s.TheoryID] = s
+	}
+	return out, rows.Err()
+}
+
+// TheoryProgressHandler — события чтения темы
+//
+//	POST   /api/theory/{id}/heartbeat {"seconds": 30} — время, проведённое на странице
+//	POST   /api/theory/{id}/complete                  — отметить тему изученной
+//	DELETE /api/theory/{id}/complete                  — снять отметку
+func TheoryProgressHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/theory/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	theoryID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid theory ID", http.StatusBadRequest)
+		return
+	}
+
+	claims := getClaims(r.Context())
+	if claims == nil {
+		http.Error(w, "Не авторизован", http.StatusUnauthorized)
+		return
+	}
+	userID, err := currentUserID(claims)
+	if err != nil {
+		http.Error(w, "Не удалось определить ID", http.StatusInternalServerError)
+		return
+	}
+
+	var exists bool
+	if err := db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM theory WHERE id = $1)`, theoryID,
+	).Scan(&exists); err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Theory not found", http.StatusNotFound)
+		return
+	}
+
+	var query string
+	var args []interface{}
+	switch {
+	case parts[1] == "heartbeat" && r.Method == http.MethodPost:
+		var req struct {
+			Seconds int `json:"seconds"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Seconds < 0 {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+		query = `
+            INSERT INTO theory_views (user_id, theory_id, time_spent, last_seen_at)
+            VALUES ($1, $2, $3, NOW())
+            ON CONFLICT (user_id, theory_id) DO UPDATE
+               SET time_spent   = theory_views.time_spent + LEAST(EXCLUDED.time_spent,
+                       COALESCE(EXTRACT(EPOCH FROM NOW() - theory_views.last_seen_at)::int, EXCLUDED.time_spent)),
+                   last_seen_at = NOW()
+            RETURNING theory_id, time_spent, completed_at`
+		args = []interface{}{userID, theoryID, min(req.Seconds, maxHeartbeatSeconds)}
+
+	case parts[1] == "complete" && r.Method == http.MethodPost:
+		query = `
+            INSERT INTO theory_views (user_id, theory_id, last_seen_at, completed_at)
+            VALUES ($1, $2, NOW(), NOW())
+            ON CONFLICT (user_id, theory_id) DO UPDATE
+               SET completed_at = COALESCE(theory_views.completed_at, NOW())
+            RETURNING theory_id, time_spent, completed_at`
+		args = []interface{}{userID, theoryID}
+
+	case parts[1] == "complete" && r.Method == http.MethodDelete:
+		query = `
+            INSERT INTO theory_views (user_id, theory_id)
+            VALUES ($1, $2)
+            ON CONFLICT (user_id, theory_id) DO UPDATE SET completed_at = NULL
+            RETURNING theory_id, time_spent, completed_at`
+		args = []interface{}{userID, theoryID}
+
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	var (
+		state     theoryState
+		completed sql.NullTime
+	)
+	if err := db.QueryRow(query, args...).Scan(&state.TheoryID, &state.TimeSpent, &completed); err != nil {
+		log.Println("TheoryProgressHandler error:", err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if completed.Valid {
+		state.Completed = true
+		state.CompletedAt = &completed.Time
+	}
+	respondWithJSON(w, http.StatusOK, state)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+)
+
+// attemptGracePeriod — запас после дедлайна (в секундах) на сетевые задержки:
+// ответ, отправленный в последний момент, ещё принимается
+const attemptGracePeriod = 10
+
+// validTimeLimit проверяет лимит времени теста в минутах (0 — без ограничения)
+func validTimeLimit(minutes int) bool {
+	return minutes >= 0 && minutes <= 24*60
+}
+
+// closeAttempt завершает попытку по истечении времени: finished_at ставится
+// равным дедлайну, итоги пересчитываются по уже сохранённым ответам
+func closeAttempt(q queryer, attemptID int) error {
+	if _, err := q.Exec(`
+        UPDATE user_test_attempts
+           SET finished_at = deadline_at
+         WHERE id = $1 AND finished_at IS NULL
+    `, attemptID); err != nil {
+		return err
+	}
+	_, _, _, err := recalcAttemptTotals(q, attemptID)
+	return err
+}
+
+// FinishExpiredAttempts завершает и оценивает все попытки, у которых
+// истёк дедлайн. Запускается по расписанию из main.
+func FinishExpiredAttempts(db *sql.DB) error {
+	rows, err := db.Query(`
+        SELECT id FROM user_test_attempts
+         WHERE finished_at IS NULL
+           AND deadline_at + make_interval(secs => $1) < NOW()
+    `, attemptGracePeriod)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := closeAttempt(tx, id); err != nil {
+			tx.Rollback()
+			log.Printf("FinishExpiredAttempts: попытка %d: %v", id, err)
+			continue
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("Завершено попыток по истечении времени: %d", len(ids))
+	}
+	return nil
+}
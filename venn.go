@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"registration_form/setexpr"
+)
+
+// GET /api/venn?expr=(A∪B)∩C&sets=3
+// Отдаёт SVG-диаграмму Эйлера–Венна с закрашенными областями выражения.
+// Картинку можно вставлять в теорию и вопросы через <img src="/api/venn?...">.
+func VennHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	src := r.URL.Query().Get("expr")
+	if src == "" {
+		http.Error(w, "Параметр expr обязателен", http.StatusBadRequest)
+		return
+	}
+	e, err := setexpr.Parse(src)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// По умолчанию кругов столько, сколько множеств в выражении (минимум два)
+	n := max(len(setexpr.Vars(e)), 2)
+	if s := r.URL.Query().Get("sets"); s != "" {
+		if n, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "Invalid sets", http.StatusBadRequest)
+			return
+		}
+	}
+
+	svg, err := setexpr.VennSVG(e, n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Write([]byte(svg))
+}